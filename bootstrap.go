@@ -0,0 +1,156 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ringpop
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uber/ringpop-go/discovery"
+	"github.com/uber/ringpop-go/swim"
+	"golang.org/x/net/context"
+)
+
+// bootstrapRetryInterval is the time BootstrapAsync waits before it makes a
+// new bootstrap attempt after the previous one failed.
+const bootstrapRetryInterval = time.Second
+
+// errNoBootstrapHosts is returned by the discover provider used during an
+// asynchronous bootstrap when the real provider did not return any hosts yet.
+var errNoBootstrapHosts = errors.New("discover provider returned no hosts")
+
+// A BootstrapHandle tracks a bootstrap that was started with BootstrapAsync.
+type BootstrapHandle struct {
+	done   chan struct{}
+	joined []string
+	err    error
+}
+
+// Done returns a channel that is closed when the asynchronous bootstrap has
+// completed, either because the ring was joined, or because the context was
+// cancelled or Ringpop was destroyed.
+func (h *BootstrapHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns nil as long as the bootstrap is in progress or when it
+// succeeded. When the bootstrap was aborted it returns the reason.
+func (h *BootstrapHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Joined returns the nodes that were joined during a successful bootstrap. It
+// returns nil while the bootstrap is in progress.
+func (h *BootstrapHandle) Joined() []string {
+	select {
+	case <-h.done:
+		return h.joined
+	default:
+		return nil
+	}
+}
+
+func (h *BootstrapHandle) finish(joined []string, err error) {
+	h.joined = joined
+	h.err = err
+	close(h.done)
+}
+
+// nonEmptyDiscoverProvider wraps a DiscoverProvider and turns an empty host
+// list into an error so that an asynchronous bootstrap keeps waiting for hosts
+// instead of creating a single-node cluster.
+type nonEmptyDiscoverProvider struct {
+	discovery.DiscoverProvider
+}
+
+func (p nonEmptyDiscoverProvider) Hosts() ([]string, error) {
+	hosts, err := p.DiscoverProvider.Hosts()
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, errNoBootstrapHosts
+	}
+	return hosts, nil
+}
+
+// BootstrapAsync starts communication for this Ringpop instance without
+// blocking the caller. The returned handle is completed when the ring has
+// been joined, Ready will return true from that moment on.
+//
+// Failed bootstrap attempts are retried in the background until one succeeds.
+// Different from Bootstrap, an empty host list from the DiscoverProvider is
+// not treated as a single-node cluster but as hosts not being available yet;
+// a single-node cluster is still created when the provider only returns the
+// identity of this Ringpop instance.
+//
+// Cancelling the context stops further attempts and completes the handle with
+// the error of the context. An attempt that is already in progress is not
+// interrupted and is bounded by MaxJoinDuration.
+func (rp *Ringpop) BootstrapAsync(ctx context.Context, bootstrapOpts *swim.BootstrapOptions) *BootstrapHandle {
+	h := &BootstrapHandle{
+		done: make(chan struct{}),
+	}
+
+	var opts swim.BootstrapOptions
+	if bootstrapOpts != nil {
+		opts = *bootstrapOpts
+	}
+	if opts.DiscoverProvider != nil {
+		opts.DiscoverProvider = nonEmptyDiscoverProvider{opts.DiscoverProvider}
+	}
+
+	go rp.bootstrapAsync(ctx, &opts, h)
+
+	return h
+}
+
+type bootstrapResult struct {
+	joined []string
+	err    error
+}
+
+func (rp *Ringpop) bootstrapAsync(ctx context.Context, opts *swim.BootstrapOptions, h *BootstrapHandle) {
+	for {
+		if rp.destroyed() {
+			h.finish(nil, ErrDestroyed)
+			return
+		}
+
+		joined, err := rp.BootstrapContext(ctx, opts)
+		if err == nil {
+			h.finish(joined, nil)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			h.finish(nil, ctx.Err())
+			return
+		case <-rp.clock.After(bootstrapRetryInterval):
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package ringpop
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrNotBootstrapped is returned by public methods which require the ring to
@@ -11,4 +14,23 @@ var (
 	// using port 0 and is not listening (and thus has not been assigned a port by
 	// the OS).
 	ErrEphemeralIdentity = errors.New("unable to resolve this node's identity from channel that is not yet listening")
+
+	// ErrDestroyed is returned when an operation is aborted because the Ringpop
+	// instance has been destroyed.
+	ErrDestroyed = errors.New("ringpop is destroyed")
 )
+
+// A ForwardLoopError is returned by HandleOrForwardContext when a request that
+// was already forwarded by another node is not owned by this node either, and
+// the FailLoops policy is configured.
+type ForwardLoopError struct {
+	Key         string
+	Origin      string
+	Destination string
+	Hops        int
+}
+
+func (e *ForwardLoopError) Error() string {
+	return fmt.Sprintf("request for key %q forwarded %d times from %s would be forwarded again to %s",
+		e.Key, e.Hops, e.Origin, e.Destination)
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/uber/ringpop-go/util"
+)
+
+// ErrCircuitOpen is returned when a request is not sent because the circuit
+// breaker of its destination is open and it could not be rerouted.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker of a destination.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through to the destination.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen rejects all requests to the destination.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a limited number of requests through to probe if
+	// the destination has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOptions configure the circuit breakers of a forwarder.
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive failed calls after which
+	// the circuit of a destination opens.
+	FailureThreshold int
+
+	// OpenDuration is the time a circuit stays open before probe requests
+	// are let through.
+	OpenDuration time.Duration
+
+	// HalfOpenRequests is the number of concurrent probe requests that is let
+	// through while the circuit is half-open.
+	HalfOpenRequests int
+
+	// Reroute sends requests for a destination with an open circuit to the
+	// next owner of the keys instead of failing them. It requires a Sender
+	// that implements LookupN.
+	Reroute bool
+}
+
+func defaultBreakerOptions() BreakerOptions {
+	return BreakerOptions{
+		FailureThreshold: 5,
+		OpenDuration:     5 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+func mergeBreakerOptions(opts BreakerOptions) BreakerOptions {
+	def := defaultBreakerOptions()
+
+	opts.FailureThreshold = util.SelectInt(opts.FailureThreshold, def.FailureThreshold)
+	opts.OpenDuration = util.SelectDuration(opts.OpenDuration, def.OpenDuration)
+	opts.HalfOpenRequests = util.SelectInt(opts.HalfOpenRequests, def.HalfOpenRequests)
+
+	return opts
+}
+
+// callOutcome is the outcome of a call as reported to a circuit breaker.
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	// callAbandoned is reported for calls that were cancelled by the sender,
+	// they say nothing about the health of the destination.
+	callAbandoned
+)
+
+// A circuitBreaker tracks the health of a single destination.
+type circuitBreaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// breakers holds the circuit breakers of all destinations of a forwarder.
+type breakers struct {
+	sync.Mutex
+	opts     BreakerOptions
+	clock    clock.Clock
+	emitter  eventEmitter
+	circuits map[string]*circuitBreaker
+}
+
+func newBreakers(opts BreakerOptions, c clock.Clock, emitter eventEmitter) *breakers {
+	return &breakers{
+		opts:     mergeBreakerOptions(opts),
+		clock:    c,
+		emitter:  emitter,
+		circuits: make(map[string]*circuitBreaker),
+	}
+}
+
+func (b *breakers) circuit(destination string) *circuitBreaker {
+	c, ok := b.circuits[destination]
+	if !ok {
+		c = &circuitBreaker{}
+		b.circuits[destination] = c
+	}
+	return c
+}
+
+// setState changes the state of the circuit of the destination and emits a
+// BreakerStateChangedEvent. It must be called with the lock held.
+func (b *breakers) setState(destination string, c *circuitBreaker, state BreakerState) {
+	old := c.state
+	c.state = state
+	c.failures = 0
+	c.probes = 0
+	if state == BreakerOpen {
+		c.openedAt = b.clock.Now()
+	}
+
+	b.emitter.emit(BreakerStateChangedEvent{
+		Destination: destination,
+		OldState:    old,
+		NewState:    state,
+	})
+}
+
+// allow returns whether a call to the destination may be made. Every allowed
+// call must be followed by a call to report.
+func (b *breakers) allow(destination string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	c := b.circuit(destination)
+
+	if c.state == BreakerOpen {
+		if b.clock.Now().Sub(c.openedAt) < b.opts.OpenDuration {
+			return false
+		}
+		b.setState(destination, c, BreakerHalfOpen)
+	}
+
+	if c.state == BreakerHalfOpen {
+		if c.probes >= b.opts.HalfOpenRequests {
+			return false
+		}
+		c.probes++
+	}
+
+	return true
+}
+
+// report records the outcome of a call to the destination.
+func (b *breakers) report(destination string, outcome callOutcome) {
+	b.Lock()
+	defer b.Unlock()
+
+	c := b.circuit(destination)
+
+	switch c.state {
+	case BreakerClosed:
+		switch outcome {
+		case callSucceeded:
+			c.failures = 0
+		case callFailed:
+			c.failures++
+			if c.failures >= b.opts.FailureThreshold {
+				b.setState(destination, c, BreakerOpen)
+			}
+		}
+
+	case BreakerHalfOpen:
+		switch outcome {
+		case callSucceeded:
+			b.setState(destination, c, BreakerClosed)
+		case callFailed:
+			b.setState(destination, c, BreakerOpen)
+		case callAbandoned:
+			if c.probes > 0 {
+				c.probes--
+			}
+		}
+	}
+}
+
+// state returns the state of the circuit breaker of the destination.
+func (b *breakers) state(destination string) BreakerState {
+	b.Lock()
+	defer b.Unlock()
+
+	if c, ok := b.circuits[destination]; ok {
+		return c.state
+	}
+	return BreakerClosed
+}
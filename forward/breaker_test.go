@@ -0,0 +1,131 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+)
+
+type recordingEmitter struct {
+	sync.Mutex
+	events []events.Event
+}
+
+func (e *recordingEmitter) emit(event events.Event) {
+	e.Lock()
+	defer e.Unlock()
+	e.events = append(e.events, event)
+}
+
+func newTestBreakers() (*breakers, *clock.Mock, *recordingEmitter) {
+	c := clock.NewMock()
+	emitter := &recordingEmitter{}
+	b := newBreakers(BreakerOptions{
+		FailureThreshold: 2,
+		OpenDuration:     time.Second,
+	}, c, emitter)
+	return b, c, emitter
+}
+
+func TestBreakerDefaults(t *testing.T) {
+	b, _, _ := newTestBreakers()
+	assert.Equal(t, 2, b.opts.FailureThreshold)
+	assert.Equal(t, time.Second, b.opts.OpenDuration)
+	assert.Equal(t, 1, b.opts.HalfOpenRequests, "expected default for unset option")
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _, emitter := newTestBreakers()
+
+	assert.True(t, b.allow("a"))
+	b.report("a", callFailed)
+	assert.True(t, b.allow("a"))
+	b.report("a", callSucceeded)
+	assert.Equal(t, BreakerClosed, b.state("a"), "expected success to reset failures")
+
+	b.report("a", callFailed)
+	b.report("a", callFailed)
+	assert.Equal(t, BreakerOpen, b.state("a"))
+	assert.False(t, b.allow("a"), "expected open circuit to reject calls")
+	assert.True(t, b.allow("b"), "expected other destinations to be unaffected")
+
+	assert.Equal(t, []events.Event{BreakerStateChangedEvent{
+		Destination: "a",
+		OldState:    BreakerClosed,
+		NewState:    BreakerOpen,
+	}}, emitter.events)
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b, c, _ := newTestBreakers()
+
+	b.report("a", callFailed)
+	b.report("a", callFailed)
+
+	c.Add(time.Second)
+	assert.True(t, b.allow("a"), "expected a probe after the open duration")
+	assert.Equal(t, BreakerHalfOpen, b.state("a"))
+	assert.False(t, b.allow("a"), "expected a single concurrent probe")
+
+	b.report("a", callSucceeded)
+	assert.Equal(t, BreakerClosed, b.state("a"))
+	assert.True(t, b.allow("a"))
+}
+
+func TestBreakerHalfOpenProbeFails(t *testing.T) {
+	b, c, emitter := newTestBreakers()
+
+	b.report("a", callFailed)
+	b.report("a", callFailed)
+
+	c.Add(time.Second)
+	assert.True(t, b.allow("a"))
+	b.report("a", callFailed)
+	assert.Equal(t, BreakerOpen, b.state("a"))
+	assert.False(t, b.allow("a"))
+
+	assert.Len(t, emitter.events, 3)
+}
+
+func TestBreakerHalfOpenProbeAbandoned(t *testing.T) {
+	b, c, _ := newTestBreakers()
+
+	b.report("a", callFailed)
+	b.report("a", callFailed)
+
+	c.Add(time.Second)
+	assert.True(t, b.allow("a"))
+	b.report("a", callAbandoned)
+	assert.Equal(t, BreakerHalfOpen, b.state("a"))
+	assert.True(t, b.allow("a"), "expected the abandoned probe to be released")
+}
+
+func TestBreakerStateString(t *testing.T) {
+	assert.Equal(t, "closed", BreakerClosed.String())
+	assert.Equal(t, "open", BreakerOpen.String())
+	assert.Equal(t, "half-open", BreakerHalfOpen.String())
+}
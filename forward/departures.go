@@ -0,0 +1,91 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"errors"
+	"sync"
+)
+
+// errDestinationRemoved is the reason an attempt is abandoned when its
+// destination is removed from the ring while the request is in flight.
+var errDestinationRemoved = errors.New("destination was removed from the ring")
+
+// departures keeps track of the destinations of in-flight attempts, so the
+// attempts can be interrupted as soon as their destination leaves the ring
+// instead of waiting for their timeout.
+type departures struct {
+	sync.Mutex
+	watchers map[string]map[chan struct{}]struct{}
+}
+
+func newDepartures() *departures {
+	return &departures{
+		watchers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// watch returns a channel that is closed when the destination is removed from
+// the ring, and a function that stops watching the destination.
+func (d *departures) watch(destination string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	d.Lock()
+	watchers, ok := d.watchers[destination]
+	if !ok {
+		watchers = make(map[chan struct{}]struct{})
+		d.watchers[destination] = watchers
+	}
+	watchers[ch] = struct{}{}
+	d.Unlock()
+
+	return ch, func() {
+		d.Lock()
+		if watchers, ok := d.watchers[destination]; ok {
+			delete(watchers, ch)
+			if len(watchers) == 0 {
+				delete(d.watchers, destination)
+			}
+		}
+		d.Unlock()
+	}
+}
+
+// remove notifies the watchers of the destinations that the destinations were
+// removed from the ring.
+func (d *departures) remove(destinations []string) {
+	d.Lock()
+	defer d.Unlock()
+
+	for _, destination := range destinations {
+		for ch := range d.watchers[destination] {
+			close(ch)
+		}
+		delete(d.watchers, destination)
+	}
+}
+
+// watched returns whether an attempt to the destination is being watched.
+func (d *departures) watched(destination string) bool {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.watchers[destination]) > 0
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(10 * time.Millisecond):
+		return false
+	}
+}
+
+func TestDeparturesRemove(t *testing.T) {
+	d := newDepartures()
+
+	first, _ := d.watch("192.0.2.1:1")
+	second, _ := d.watch("192.0.2.1:1")
+	other, _ := d.watch("192.0.2.2:1")
+
+	d.remove([]string{"192.0.2.1:1"})
+
+	assert.True(t, closed(first), "expected watchers of the removed destination to be notified")
+	assert.True(t, closed(second), "expected watchers of the removed destination to be notified")
+	assert.False(t, closed(other), "expected watchers of other destinations not to be notified")
+	assert.False(t, d.watched("192.0.2.1:1"))
+	assert.True(t, d.watched("192.0.2.2:1"))
+}
+
+func TestDeparturesStopWatching(t *testing.T) {
+	d := newDepartures()
+
+	ch, stop := d.watch("192.0.2.1:1")
+	stop()
+	assert.False(t, d.watched("192.0.2.1:1"))
+
+	d.remove([]string{"192.0.2.1:1"})
+	assert.False(t, closed(ch), "expected no notification after watching stopped")
+
+	// stopping after the destination was removed is a no-op
+	ch, stop = d.watch("192.0.2.1:1")
+	d.remove([]string{"192.0.2.1:1"})
+	assert.True(t, closed(ch))
+	stop()
+}
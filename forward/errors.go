@@ -0,0 +1,101 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import "time"
+
+// RequestInfo describes a forwarded request at the moment it failed.
+type RequestInfo struct {
+	// Destination is the destination of the last attempt.
+	Destination string
+	Keys        []string
+
+	// Attempts is the number of attempts that were made, including retries.
+	Attempts int
+
+	// Elapsed is the time since the first attempt was started.
+	Elapsed time.Duration
+}
+
+// A TimeoutError is returned when the destination did not respond within the
+// timeout of an attempt. Timed out attempts are not retried.
+type TimeoutError struct {
+	RequestInfo
+}
+
+func (e *TimeoutError) Error() string {
+	return "request timed out"
+}
+
+// An UnreachableError is returned when the destination could not be reached
+// or did not complete the call, and the error is not retried.
+type UnreachableError struct {
+	RequestInfo
+
+	// Err is the error of the last call.
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return e.Err.Error()
+}
+
+// A DivergedError is returned when the keys of a request that is retried are
+// no longer owned by a single destination.
+type DivergedError struct {
+	RequestInfo
+
+	// Destinations are the current owners of the keys.
+	Destinations []string
+}
+
+func (e *DivergedError) Error() string {
+	return "key destinations have diverged"
+}
+
+// An ApplicationError is returned when the destination handled the request
+// but responded with an application error. Application errors are never
+// retried.
+type ApplicationError struct {
+	RequestInfo
+
+	Type    string
+	Message string
+}
+
+func (e *ApplicationError) Error() string {
+	return e.Message
+}
+
+// A MaxRetriesError is returned when the request still failed after the
+// maximum number of retries.
+type MaxRetriesError struct {
+	RequestInfo
+
+	MaxRetries int
+
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *MaxRetriesError) Error() string {
+	return "max retries exceeded"
+}
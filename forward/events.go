@@ -1,6 +1,10 @@
 package forward
 
-import "github.com/uber/ringpop-go/events"
+import (
+	"time"
+
+	"github.com/uber/ringpop-go/events"
+)
 
 // An EventListener handles events given to it by the SWIM node. HandleEvent should be thread safe.
 type eventEmitter interface {
@@ -31,11 +35,51 @@ type InflightRequestsMiscountEvent struct {
 	Operation InflightCountOperation
 }
 
-// A SuccessEvent is emitted when the forwarded request responded without an error
-type SuccessEvent struct{}
+// A InflightLimitRejectedEvent is emitted when a request is rejected because an
+// inflight limit was reached
+type InflightLimitRejectedEvent struct {
+	Destination string
+	Global      bool
+}
 
-// A FailedEvent is emitted when the forwarded request responded with an error
-type FailedEvent struct{}
+// A LoopDetectedEvent is emitted when a request that was already forwarded is
+// not owned by the node that received it, and would be forwarded again
+type LoopDetectedEvent struct {
+	Key         string
+	Origin      string
+	Destination string
+	Hops        int
+}
+
+// A ChecksumMismatchEvent is emitted when a forwarded request was sent by a
+// node whose ring checksum differs from the ring checksum of the receiver
+type ChecksumMismatchEvent struct {
+	Key            string
+	Origin         string
+	LocalChecksum  uint32
+	SenderChecksum uint32
+}
+
+// A SuccessEvent is emitted when the forwarded request responded without an
+// error. Destination is the node that responded, Duration includes retries and
+// Attempts counts the calls made to send the request.
+type SuccessEvent struct {
+	Destination string
+	Service     string
+	Endpoint    string
+	Duration    time.Duration
+	Attempts    int
+}
+
+// A FailedEvent is emitted when the forwarded request responded with an
+// error. Attempts is zero when the request was rejected before it was sent.
+type FailedEvent struct {
+	Destination string
+	Service     string
+	Endpoint    string
+	Duration    time.Duration
+	Attempts    int
+}
 
 // A MaxRetriesEvent is emitted when the sender failed to complete the request after the maximum specified amount of retries
 type MaxRetriesEvent struct {
@@ -50,13 +94,59 @@ type RetryAbortEvent struct {
 	Reason string
 }
 
+// A RetryBudgetExhaustedEvent is emitted when a request is not retried because
+// the retry budget of the forwarder is exhausted
+type RetryBudgetExhaustedEvent struct{}
+
 // A RerouteEvent is emitted when a forwarded request is being rerouted to a new destination
 type RerouteEvent struct {
 	OldDestination string
 	NewDestination string
 }
 
+// A DestinationRemovedEvent is emitted when an attempt of a forwarded request
+// is abandoned because its destination was removed from the ring
+type DestinationRemovedEvent struct {
+	Destination string
+}
+
 // A RetrySuccessEvent is emitted after a retry resulted in a successful forwarded request
 type RetrySuccessEvent struct {
 	NumRetries int
 }
+
+// A HedgeSentEvent is emitted when a duplicate request is sent to the next
+// owner of the keys because the destination did not respond in time
+type HedgeSentEvent struct {
+	Destination      string
+	HedgeDestination string
+	Delay            time.Duration
+}
+
+// A HedgeWonEvent is emitted when the response of the duplicate request was
+// returned instead of the response of the destination
+type HedgeWonEvent struct {
+	Destination      string
+	HedgeDestination string
+}
+
+// A BreakerStateChangedEvent is emitted when the circuit breaker of a
+// destination changes state
+type BreakerStateChangedEvent struct {
+	Destination string
+	OldState    BreakerState
+	NewState    BreakerState
+}
+
+// A BreakerRejectedEvent is emitted when a request is failed because the
+// circuit breaker of its destination is open
+type BreakerRejectedEvent struct {
+	Destination string
+}
+
+// A BreakerRerouteEvent is emitted when a request is sent to the next owner of
+// its keys because the circuit breaker of its destination is open
+type BreakerRerouteEvent struct {
+	OldDestination string
+	NewDestination string
+}
@@ -25,13 +25,16 @@ import (
 	"sync"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	log "github.com/uber-common/bark"
 	"github.com/uber/ringpop-go/events"
 	"github.com/uber/ringpop-go/logging"
 	"github.com/uber/ringpop-go/shared"
+	"github.com/uber/ringpop-go/tracing"
 	"github.com/uber/ringpop-go/util"
 	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
 )
 
 // A Sender is used to route the request to the proper destination,
@@ -44,6 +47,17 @@ type Sender interface {
 	Lookup(string) (string, error)
 }
 
+// A lookupNSender is a Sender that can also return multiple owners of a key.
+// Hedged requests are sent to the next owner, which is only known when the
+// Sender implements this interface.
+type lookupNSender interface {
+	Sender
+
+	// LookupN should return the n servers the request belongs to, in order
+	// of preference
+	LookupN(string, int) ([]string, error)
+}
+
 // Options for the creation of a forwarder
 type Options struct {
 	MaxRetries     int
@@ -51,6 +65,33 @@ type Options struct {
 	RetrySchedule  []time.Duration
 	Timeout        time.Duration
 	Headers        []byte
+
+	// RetryPolicy determines the delay before every retry. When it is not set
+	// the delays of RetrySchedule are used.
+	RetryPolicy RetryPolicy
+
+	// Retryable classifies which errors of forwarded calls are retried. It
+	// defaults to IsRetryable. Application errors are never retried.
+	Retryable func(error) bool
+
+	// Hedge enables hedged requests. When the destination did not respond
+	// within the hedge delay a duplicate request is sent to the next owner of
+	// the keys, the first response is returned and the other call is
+	// cancelled. The next owner must be able to serve the request, which
+	// makes hedging mostly useful for reads of replicated data.
+	Hedge bool
+
+	// HedgeDelay is the time to wait for a response before the duplicate
+	// request is sent. When it is not set the p95 of the recent latencies to
+	// the destination is used; no hedge is sent until enough latencies have
+	// been recorded.
+	HedgeDelay time.Duration
+
+	// RawHeaders sends the forwarding headers of requests in the raw format
+	// JSON encoded in arg2 when Headers is not set, for the destination to read
+	// them with ContextWithRawHeaders. Without it arg2 of raw requests is sent
+	// as is.
+	RawHeaders bool
 }
 
 func (f *Forwarder) defaultOptions() *Options {
@@ -58,6 +99,7 @@ func (f *Forwarder) defaultOptions() *Options {
 		MaxRetries:    3,
 		RetrySchedule: []time.Duration{3 * time.Second, 6 * time.Second, 12 * time.Second},
 		Timeout:       3 * time.Second,
+		Retryable:     IsRetryable,
 	}
 }
 
@@ -80,6 +122,16 @@ func (f *Forwarder) mergeDefaultOptions(opts *Options) *Options {
 	}
 	merged.Headers = opts.Headers
 
+	merged.RetryPolicy = opts.RetryPolicy
+	merged.Retryable = opts.Retryable
+	if opts.Retryable == nil {
+		merged.Retryable = IsRetryable
+	}
+
+	merged.Hedge = opts.Hedge
+	merged.HedgeDelay = opts.HedgeDelay
+	merged.RawHeaders = opts.RawHeaders
+
 	return &merged
 }
 
@@ -89,25 +141,127 @@ type Forwarder struct {
 	channel shared.SubChannel
 	logger  log.Logger
 
+	tracer tracing.Tracer
+	clock  clock.Clock
+
+	latencies *latencyTracker
+
+	// stats tracks the outcome of the requests sent to every destination
+	stats *latencyTracker
+
+	breakerOpts *BreakerOptions
+	breakers    *breakers
+
+	limitOpts *LimitOptions
+	limiter   *limiter
+
+	budget *retryBudget
+
+	departures *departures
+
 	inflightLock sync.Mutex
 	inflight     int64
 
 	listeners []events.EventListener
 }
 
+// A ForwarderOption configures a Forwarder on creation.
+type ForwarderOption func(*Forwarder)
+
+// Tracer sets the tracer that creates spans for forwarded requests and
+// propagates them to the destination. A nil tracer disables tracing, which is
+// also the default.
+func Tracer(t tracing.Tracer) ForwarderOption {
+	return func(f *Forwarder) {
+		if t == nil {
+			t = tracing.NoopTracer{}
+		}
+		f.tracer = t
+	}
+}
+
+// Clock sets the clock that is used to schedule retries and hedged requests,
+// and to time the circuit breakers and inflight queues. It defaults to the
+// system clock.
+func Clock(c clock.Clock) ForwarderOption {
+	return func(f *Forwarder) {
+		if c == nil {
+			c = clock.New()
+		}
+		f.clock = c
+	}
+}
+
+// CircuitBreaker enables a circuit breaker per destination. After a number of
+// consecutive failed calls to a destination, requests to it fail fast with
+// ErrCircuitOpen, or are rerouted to the next owner of their keys, until a
+// probe request to the destination succeeds.
+func CircuitBreaker(opts BreakerOptions) ForwarderOption {
+	return func(f *Forwarder) {
+		f.breakerOpts = &opts
+	}
+}
+
+// InflightLimit limits the number of requests that are forwarded at the same
+// time, in total and per destination. Requests over a limit are queued or
+// rejected with an *InflightLimitError. The limit of a destination applies to
+// the destination a request is forwarded to, not to the destinations it is
+// rerouted to on retries.
+func InflightLimit(opts LimitOptions) ForwarderOption {
+	return func(f *Forwarder) {
+		f.limitOpts = &opts
+	}
+}
+
+// RetryBudget limits the number of retries of all requests of the forwarder
+// together to a ratio of the number of forwarded requests. Requests that
+// would be retried when the budget is exhausted fail with
+// ErrRetryBudgetExhausted.
+func RetryBudget(opts RetryBudgetOptions) ForwarderOption {
+	return func(f *Forwarder) {
+		f.budget = newRetryBudget(opts)
+	}
+}
+
 // NewForwarder returns a new forwarder
-func NewForwarder(s Sender, ch shared.SubChannel) *Forwarder {
+func NewForwarder(s Sender, ch shared.SubChannel, opts ...ForwarderOption) *Forwarder {
 
 	logger := logging.Logger("forwarder")
 	if identity, err := s.WhoAmI(); err == nil {
 		logger = logger.WithField("local", identity)
 	}
 
-	return &Forwarder{
-		sender:  s,
-		channel: ch,
-		logger:  logger,
+	f := &Forwarder{
+		sender:     s,
+		channel:    ch,
+		logger:     logger,
+		tracer:     tracing.NoopTracer{},
+		clock:      clock.New(),
+		latencies:  newLatencyTracker(),
+		stats:      newLatencyTracker(),
+		departures: newDepartures(),
 	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	if f.breakerOpts != nil {
+		f.breakers = newBreakers(*f.breakerOpts, f.clock, f)
+	}
+
+	if f.limitOpts != nil {
+		f.limiter = newLimiter(*f.limitOpts, f.clock)
+	}
+
+	return f
+}
+
+// Stats returns the stats of the last requests forwarded to every
+// destination, up to 100 per destination. Requests that were rejected by the
+// inflight limits are not included.
+func (f *Forwarder) Stats() map[string]DestinationStats {
+	return f.stats.stats()
 }
 
 func (f *Forwarder) emit(event events.Event) {
@@ -116,6 +270,15 @@ func (f *Forwarder) emit(event events.Event) {
 	}
 }
 
+// HandleEvent lets the forwarder follow the changes of the ring the sender
+// looks up destinations in. In-flight requests that are rerouted on retries
+// are rerouted immediately when their destination is removed from the ring.
+func (f *Forwarder) HandleEvent(event events.Event) {
+	if event, ok := event.(events.RingChangedEvent); ok && len(event.ServersRemoved) > 0 {
+		f.departures.remove(event.ServersRemoved)
+	}
+}
+
 // RegisterListener adds a listener to the forwarder. The listener's HandleEvent
 // will be called for every emit on Forwarder. The HandleEvent method must be thread safe
 func (f *Forwarder) RegisterListener(l events.EventListener) {
@@ -156,18 +319,87 @@ func (f *Forwarder) decrementInflight() {
 func (f *Forwarder) ForwardRequest(request []byte, destination, service, endpoint string,
 	keys []string, format tchannel.Format, opts *Options) ([]byte, error) {
 
+	return f.ForwardRequestContext(context.Background(), request, destination, service, endpoint,
+		keys, format, opts)
+}
+
+// ForwardRequestContext is like ForwardRequest but takes the context of the
+// caller. The deadline of the context limits the timeout of every attempt and
+// cancelling the context aborts the request, including pending retries. When
+// no headers are set in the options, the headers carried by the context are
+// forwarded to the destination for the JSON and Thrift formats.
+//
+// A span is created around the forwarded request and each of its attempts.
+// It becomes a child of the span carried by the context or, when there is
+// none, of the span in the headers of the incoming request.
+func (f *Forwarder) ForwardRequestContext(ctx context.Context, request []byte, destination, service,
+	endpoint string, keys []string, format tchannel.Format, opts *Options) ([]byte, error) {
+
 	f.emit(RequestForwardedEvent{})
+	startTime := f.clock.Now()
+
+	span := startForwardSpan(f.tracer, tracing.ParentFromContext(f.tracer, ctx), destination,
+		service, endpoint, keys)
+
+	if f.limiter != nil {
+		release, err := f.limiter.acquire(ctx, destination)
+		if err != nil {
+			if limitErr, ok := err.(*InflightLimitError); ok {
+				f.emit(InflightLimitRejectedEvent{
+					Destination: destination,
+					Global:      limitErr.Global,
+				})
+			}
+			finishSpan(span, err)
+			f.emit(FailedEvent{
+				Destination: destination,
+				Service:     service,
+				Endpoint:    endpoint,
+				Duration:    f.clock.Now().Sub(startTime),
+			})
+			return nil, err
+		}
+		defer release()
+	}
+
+	if f.budget != nil {
+		f.budget.deposit()
+	}
 
 	f.incrementInflight()
 	opts = f.mergeDefaultOptions(opts)
-	rs := newRequestSender(f.sender, f, f.channel, request, keys, destination, service, endpoint, format, opts)
+	rs := newRequestSender(ctx, f.sender, f, f.channel, request, keys, destination, service, endpoint, format, opts)
+	rs.tracer = f.tracer
+	rs.span = span
+	rs.latencies = f.latencies
+	rs.breakers = f.breakers
+	rs.budget = f.budget
+	rs.clock = f.clock
+	rs.departures = f.departures
 	b, err := rs.Send()
 	f.decrementInflight()
 
+	finishSpan(span, err)
+
+	info := rs.info()
+	duration := f.clock.Now().Sub(startTime)
+	f.stats.add(info.Destination, duration, err != nil)
 	if err != nil {
-		f.emit(FailedEvent{})
+		f.emit(FailedEvent{
+			Destination: info.Destination,
+			Service:     service,
+			Endpoint:    endpoint,
+			Duration:    duration,
+			Attempts:    info.Attempts,
+		})
 	} else {
-		f.emit(SuccessEvent{})
+		f.emit(SuccessEvent{
+			Destination: info.Destination,
+			Service:     service,
+			Endpoint:    endpoint,
+			Duration:    duration,
+			Attempts:    info.Attempts,
+		})
 	}
 
 	return b, err
@@ -178,6 +410,12 @@ var (
 	staticForwardHeaders = map[string]string{forwardedHeaderName: "true"}
 )
 
+// forwardedRoutingDelegate is sent as the routing delegate transport header of
+// forwarded calls. Unlike the forwarded header in arg2, it can be read before
+// the arguments of a call, so a Proxy can still pass the call to its local
+// handler.
+const forwardedRoutingDelegate = "ringpop-forwarded"
+
 // SetForwardedHeader adds a header to the current thrift context indicating
 // that the call has been forwarded by another node in the ringpop ring.
 // This header is used when a remote call is received to determine if forwarding
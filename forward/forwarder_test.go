@@ -24,16 +24,21 @@ import (
 	"bytes"
 	json2 "encoding/json"
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
 
 	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/benbjohnson/clock"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"github.com/uber/ringpop-go/events"
 	"github.com/uber/ringpop-go/test/thrift/pingpong"
+	"github.com/uber/ringpop-go/tracing"
 	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/json"
+	"github.com/uber/tchannel-go/raw"
 	"github.com/uber/tchannel-go/thrift"
 	"golang.org/x/net/context"
 )
@@ -56,15 +61,16 @@ func (p Ping) Bytes() []byte {
 }
 
 type Pong struct {
-	Message string `json:"message"`
-	From    string `json:"from"`
-	Headers map[string]string
+	Message  string `json:"message"`
+	From     string `json:"from"`
+	Headers  map[string]string
+	Delegate string
 }
 
 func (s *ForwarderTestSuite) registerPong(address string, channel *tchannel.Channel) {
 	hmap := map[string]interface{}{
 		"/ping": func(ctx json.Context, ping *Ping) (*Pong, error) {
-			return &Pong{"Hello, world!", address, ctx.Headers()}, nil
+			return &Pong{"Hello, world!", address, ctx.Headers(), tchannel.CurrentCall(ctx).RoutingDelegate()}, nil
 		},
 		"/error": func(ctx json.Context, ping *Ping) (*Pong, error) {
 			return nil, errors.New("remote error")
@@ -72,6 +78,16 @@ func (s *ForwarderTestSuite) registerPong(address string, channel *tchannel.Chan
 	}
 	s.Require().NoError(json.Register(channel, hmap, func(ctx context.Context, err error) {}))
 
+	// responds with arg2 of the raw call
+	channel.Register(tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		args, err := raw.ReadArgs(call)
+		if err != nil {
+			call.Response().SendSystemError(err)
+			return
+		}
+		raw.WriteResponse(call.Response(), &raw.Res{Arg3: args.Arg2})
+	}), "/raw")
+
 	thriftHandler := &pingpong.MockTChanPingPong{}
 
 	// successful request
@@ -141,7 +157,177 @@ func (s *ForwarderTestSuite) TestForwardJSON() {
 	s.NoError(json2.Unmarshal(res, &pong))
 	s.Equal("correct pinging host", pong.From)
 	s.Equal("Hello, world!", pong.Message)
-	s.Equal(map[string]string{"hdr1": "val1"}, pong.Headers)
+	s.Equal(map[string]string{
+		"hdr1":              "val1",
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "1",
+		"ringpop-origin":    "192.0.2.1:1",
+	}, pong.Headers)
+}
+
+func (s *ForwarderTestSuite) TestForwardRaw() {
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	arg2, err := s.forwarder.ForwardRequest([]byte("request"), dest, "test", "/raw",
+		[]string{"reachable"}, tchannel.Raw, nil)
+	s.NoError(err)
+	s.Empty(arg2, "expected arg2 of a raw request to be sent as is")
+
+	arg2, err = s.forwarder.ForwardRequest([]byte("request"), dest, "test", "/raw",
+		[]string{"reachable"}, tchannel.Raw, &Options{Headers: []byte("caller")})
+	s.NoError(err)
+	s.Equal([]byte("caller"), arg2)
+
+	arg2, err = s.forwarder.ForwardRequest([]byte("request"), dest, "test", "/raw",
+		[]string{"reachable"}, tchannel.Raw, &Options{RawHeaders: true})
+	s.NoError(err)
+
+	origin, hops, ok := ForwardedFrom(ContextWithRawHeaders(context.Background(), arg2))
+	s.True(ok, "expected the forwarding headers to be JSON encoded in arg2")
+	s.Equal("192.0.2.1:1", origin)
+	s.Equal(1, hops)
+}
+
+// checksumSenderStub is a Sender that knows the checksum of its ring.
+type checksumSenderStub struct {
+	Sender
+	checksum uint32
+}
+
+func (c checksumSenderStub) Checksum() (uint32, error) {
+	return c.checksum, nil
+}
+
+func (s *ForwarderTestSuite) TestForwardJSONChecksum() {
+	var ping Ping
+	var pong Pong
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	forwarder := NewForwarder(checksumSenderStub{s.sender, 1234}, s.channel.GetSubChannel("forwarder"))
+
+	res, err := forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"reachable"},
+		tchannel.JSON, nil)
+	s.NoError(err, "expected request to be forwarded")
+
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal("1234", pong.Headers["ringpop-checksum"], "expected the checksum of the sender")
+}
+
+func (s *ForwarderTestSuite) TestForwardSuccessEvent() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	events := make(chan SuccessEvent, 1)
+
+	listener := &EventListener{}
+	listener.On("HandleEvent", mock.AnythingOfTypeArgument("forward.SuccessEvent")).Run(func(args mock.Arguments) {
+		events <- args.Get(0).(SuccessEvent)
+	}).Return()
+	listener.On("HandleEvent", mock.Anything).Return()
+
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"))
+	forwarder.RegisterListener(listener)
+
+	_, err = forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"reachable"},
+		tchannel.JSON, nil)
+	s.NoError(err, "expected request to be forwarded")
+
+	select {
+	case event := <-events:
+		s.Equal(dest, event.Destination)
+		s.Equal("test", event.Service)
+		s.Equal("/ping", event.Endpoint)
+		s.Equal(1, event.Attempts)
+		s.True(event.Duration > 0, "expected the duration of the request")
+	case <-time.After(time.Second):
+		s.Fail("expected a success event")
+	}
+}
+
+func (s *ForwarderTestSuite) TestForwardStats() {
+	var ping Ping
+
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"))
+
+	reachable, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+	_, err = forwarder.ForwardRequest(ping.Bytes(), reachable, "test", "/ping", []string{"reachable"},
+		tchannel.JSON, nil)
+	s.NoError(err)
+
+	failing, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+	_, err = forwarder.ForwardRequest(ping.Bytes(), failing, "test", "/ping", []string{"immediate fail"},
+		tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Millisecond},
+		})
+	s.Error(err)
+
+	stats := forwarder.Stats()
+	s.Equal(1, stats[reachable].Requests)
+	s.Equal(0, stats[reachable].Errors)
+	s.True(stats[reachable].LatencyP50 > 0, "expected the latency of the request")
+	s.Equal(1, stats[failing].Requests)
+	s.Equal(1, stats[failing].Errors)
+}
+
+// movingSenderStub is a Sender whose keys are all owned by a single node that
+// can be changed.
+type movingSenderStub struct {
+	Sender
+
+	sync.Mutex
+	owner string
+}
+
+func (m *movingSenderStub) Lookup(string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.owner, nil
+}
+
+func (m *movingSenderStub) move(owner string) {
+	m.Lock()
+	m.owner = owner
+	m.Unlock()
+}
+
+func (s *ForwarderTestSuite) TestForwardReroutedWhenDestinationRemoved() {
+	var ping Ping
+	var pong Pong
+
+	unreachable := "192.0.2.128:1"
+	sender := &movingSenderStub{Sender: s.sender, owner: unreachable}
+	forwarder := NewForwarder(sender, s.channel.GetSubChannel("forwarder"))
+
+	go func() {
+		// wait for the attempt to the unreachable destination
+		for !forwarder.departures.watched(unreachable) {
+			time.Sleep(time.Millisecond)
+		}
+		sender.move(s.peer.PeerInfo().HostPort)
+		forwarder.HandleEvent(events.RingChangedEvent{ServersRemoved: []string{unreachable}})
+	}()
+
+	start := time.Now()
+	res, err := forwarder.ForwardRequest(ping.Bytes(), unreachable, "test", "/ping", []string{"moved"},
+		tchannel.JSON, &Options{
+			MaxRetries:     1,
+			RerouteRetries: true,
+			RetrySchedule:  []time.Duration{time.Millisecond},
+			Timeout:        10 * time.Second,
+		})
+	s.NoError(err, "expected request to be rerouted")
+	s.True(time.Since(start) < 5*time.Second, "expected request to be rerouted before it timed out")
+
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal("correct pinging host", pong.From)
 }
 
 func (s *ForwarderTestSuite) TestForwardJSONErrorResponse() {
@@ -168,6 +354,26 @@ func (s *ForwarderTestSuite) TestForwardJSONInvalidEndpoint() {
 				100 * time.Millisecond,
 			},
 		})
+	s.Require().IsType(&UnreachableError{}, err)
+	s.Equal(tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err.(*UnreachableError).Err),
+		"expected a call to an invalid endpoint not to be retried")
+	s.Equal(1, err.(*UnreachableError).Attempts)
+}
+
+func (s *ForwarderTestSuite) TestForwardJSONInvalidEndpointRetryable() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	_, err = s.forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/invalid", []string{"reachable"},
+		tchannel.JSON, &Options{
+			MaxRetries: 1,
+			RetrySchedule: []time.Duration{
+				100 * time.Millisecond,
+			},
+			Retryable: func(error) bool { return true },
+		})
 	s.EqualError(err, "max retries exceeded")
 }
 
@@ -234,6 +440,97 @@ func (s *ForwarderTestSuite) TestMaxRetries() {
 	s.EqualError(err, "max retries exceeded")
 }
 
+func (s *ForwarderTestSuite) TestRetriesDrivenByClock() {
+	var ping Ping
+
+	mockClock := clock.NewMock()
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"), Clock(mockClock))
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	done := make(chan error)
+	go func() {
+		_, err := forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"immediate fail"},
+			tchannel.JSON, &Options{
+				MaxRetries:  2,
+				RetryPolicy: ExponentialRetryPolicy{Initial: time.Hour},
+			})
+		done <- err
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			s.EqualError(err, "max retries exceeded")
+			return
+		case <-time.After(time.Millisecond):
+			mockClock.Add(time.Hour)
+		}
+	}
+}
+
+func (s *ForwarderTestSuite) TestRetryBudgetExhausted() {
+	var ping Ping
+
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"),
+		RetryBudget(RetryBudgetOptions{Burst: 1}))
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	opts := &Options{
+		MaxRetries:    1,
+		RetrySchedule: []time.Duration{time.Millisecond},
+	}
+
+	_, err = forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"immediate fail"},
+		tchannel.JSON, opts)
+	s.EqualError(err, "max retries exceeded", "expected the first request to be retried")
+
+	_, err = forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"immediate fail"},
+		tchannel.JSON, opts)
+	s.Equal(ErrRetryBudgetExhausted, err)
+}
+
+func (s *ForwarderTestSuite) TestTypedErrors() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	_, err = s.forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"immediate fail"},
+		tchannel.JSON, &Options{
+			MaxRetries:    2,
+			RetrySchedule: []time.Duration{time.Millisecond, time.Millisecond},
+		})
+	s.Require().IsType(&MaxRetriesError{}, err)
+	maxRetriesErr := err.(*MaxRetriesError)
+	s.Equal(dest, maxRetriesErr.Destination)
+	s.Equal([]string{"immediate fail"}, maxRetriesErr.Keys)
+	s.Equal(3, maxRetriesErr.Attempts)
+	s.Equal(2, maxRetriesErr.MaxRetries)
+	s.Error(maxRetriesErr.Err, "expected the error of the last attempt")
+	s.True(maxRetriesErr.Elapsed >= 2*time.Millisecond)
+
+	dest, err = s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	_, err = s.forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/error", []string{"reachable"},
+		tchannel.JSON, nil)
+	s.Require().IsType(&ApplicationError{}, err)
+	s.Equal("remote error", err.(*ApplicationError).Message)
+	s.Equal(dest, err.(*ApplicationError).Destination)
+
+	dest, err = s.sender.Lookup("unreachable")
+	s.NoError(err)
+
+	_, err = s.forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"unreachable"},
+		tchannel.JSON, &Options{Timeout: time.Millisecond})
+	s.Require().IsType(&TimeoutError{}, err)
+	s.Equal(1, err.(*TimeoutError).Attempts)
+}
+
 func (s *ForwarderTestSuite) TestLookupErrorInRetry() {
 	var ping Ping
 
@@ -312,6 +609,636 @@ func (s *ForwarderTestSuite) TestRequestNoReroutes() {
 	s.EqualError(err, "max retries exceeded")
 }
 
+func (s *ForwarderTestSuite) TestForwardJSONContextHeaders() {
+	var ping Ping
+	var pong Pong
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	ctx := json.WithHeaders(context.Background(), map[string]string{"hdr1": "val1"})
+	res, err := s.forwarder.ForwardRequestContext(ctx, ping.Bytes(), dest, "test", "/ping",
+		[]string{"reachable"}, tchannel.JSON, nil)
+	s.NoError(err, "expected request to be forwarded")
+
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal(map[string]string{
+		"hdr1":              "val1",
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "1",
+		"ringpop-origin":    "192.0.2.1:1",
+	}, pong.Headers)
+}
+
+func (s *ForwarderTestSuite) TestForwardContextCancelled() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = s.forwarder.ForwardRequestContext(ctx, ping.Bytes(), dest, "test", "/ping",
+		[]string{"reachable"}, tchannel.JSON, nil)
+	s.Equal(context.Canceled, err)
+}
+
+func (s *ForwarderTestSuite) TestForwardContextDeadline() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("unreachable")
+	s.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = s.forwarder.ForwardRequestContext(ctx, ping.Bytes(), dest, "test", "/ping", nil,
+		tchannel.JSON, &Options{Timeout: time.Minute})
+
+	s.Error(err)
+	s.True(time.Now().Sub(start) < time.Second, "expected the deadline of the context to be used")
+}
+
+func (s *ForwarderTestSuite) TestRetryAbortedOnCancel() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err = s.forwarder.ForwardRequestContext(ctx, ping.Bytes(), dest, "test", "/ping",
+		[]string{"immediate fail"}, tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Minute},
+		})
+
+	s.Equal(context.Canceled, err)
+}
+
+func (s *ForwarderTestSuite) TestForwardTraced() {
+	var ping Ping
+	var pong Pong
+
+	tracer := &recordingTracer{}
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"), Tracer(tracer))
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	parent := tracer.StartSpan("parent", nil)
+	ctx := tracing.ContextWithSpan(context.Background(), parent)
+
+	res, err := forwarder.ForwardRequestContext(ctx, ping.Bytes(), dest, "test", "/ping",
+		[]string{"reachable"}, tchannel.JSON, &Options{Headers: []byte(`{"hdr1": "val1"}`)})
+	s.NoError(err, "expected request to be forwarded")
+
+	s.Require().Len(tracer.spans, 3)
+	forward, attempt := tracer.spans[1], tracer.spans[2]
+
+	s.Equal(spanForward, forward.operation)
+	s.Equal(parent.Context(), forward.parent)
+	s.Equal(dest, forward.tags[tagDestination])
+	s.Equal("reachable", forward.tags[tagKeys])
+	s.True(forward.finished)
+
+	s.Equal(spanAttempt, attempt.operation)
+	s.Equal(forward.Context(), attempt.parent)
+	s.Equal(1, attempt.tags[tagAttempt])
+	s.True(attempt.finished)
+
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal(map[string]string{
+		"hdr1":              "val1",
+		"trace-span":        attempt.id,
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "1",
+		"ringpop-origin":    "192.0.2.1:1",
+	}, pong.Headers, "expected the span of the attempt to be propagated")
+}
+
+func (s *ForwarderTestSuite) TestForwardTracedReroute() {
+	var ping Ping
+
+	tracer := &recordingTracer{}
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"), Tracer(tracer))
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	_, err = forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"reachable"},
+		tchannel.JSON, &Options{
+			MaxRetries:     1,
+			RerouteRetries: true,
+			RetrySchedule:  []time.Duration{time.Millisecond},
+		})
+	s.NoError(err, "expected request to be rerouted")
+
+	s.Require().Len(tracer.spans, 3)
+	s.Equal(spanAttempt, tracer.spans[1].operation)
+	s.Equal(true, tracer.spans[1].tags[tagError])
+	s.Equal(spanReroute, tracer.spans[2].operation)
+	s.Equal(2, tracer.spans[2].tags[tagAttempt])
+	s.Nil(tracer.spans[2].tags[tagError])
+}
+
+func (s *ForwarderTestSuite) TestForwardHedged() {
+	var ping Ping
+	var pong Pong
+
+	dest, err := s.sender.Lookup("unreachable")
+	s.NoError(err)
+
+	sender := lookupNSenderStub{s.sender, map[string][]string{
+		"hedged": {dest, s.peer.PeerInfo().HostPort},
+	}}
+	forwarder := NewForwarder(sender, s.channel.GetSubChannel("forwarder"))
+
+	var wg sync.WaitGroup
+	wg.Add(2) // expect a hedge to be sent and to win
+
+	listener := &EventListener{}
+	listener.On("HandleEvent", mock.AnythingOfTypeArgument("forward.HedgeSentEvent")).Run(func(args mock.Arguments) {
+		wg.Done()
+	}).Return()
+	listener.On("HandleEvent", mock.AnythingOfTypeArgument("forward.HedgeWonEvent")).Run(func(args mock.Arguments) {
+		wg.Done()
+	}).Return()
+	listener.On("HandleEvent", mock.Anything).Return()
+	forwarder.RegisterListener(listener)
+
+	res, err := forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"hedged"},
+		tchannel.JSON, &Options{
+			Timeout:    time.Second,
+			Hedge:      true,
+			HedgeDelay: 10 * time.Millisecond,
+		})
+	s.NoError(err, "expected the hedged request to respond")
+
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal("correct pinging host", pong.From)
+
+	wg.Wait()
+}
+
+func (s *ForwarderTestSuite) TestForwardHedgeNotSentWithoutLookupN() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("unreachable")
+	s.NoError(err)
+
+	_, err = s.forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"unreachable"},
+		tchannel.JSON, &Options{
+			Timeout:    50 * time.Millisecond,
+			Hedge:      true,
+			HedgeDelay: time.Millisecond,
+		})
+	s.EqualError(err, "request timed out")
+}
+
+func (s *ForwarderTestSuite) TestCircuitBreakerFailsFast() {
+	var ping Ping
+
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"),
+		CircuitBreaker(BreakerOptions{FailureThreshold: 1, OpenDuration: time.Minute}))
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	_, err = forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"immediate fail"},
+		tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Millisecond},
+		})
+	s.Equal(ErrCircuitOpen, err, "expected the retry to fail fast")
+	s.Equal(BreakerOpen, forwarder.breakers.state(dest))
+}
+
+func (s *ForwarderTestSuite) TestCircuitBreakerReroutes() {
+	var ping Ping
+	var pong Pong
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	sender := lookupNSenderStub{s.sender, map[string][]string{
+		"rerouted": {dest, s.peer.PeerInfo().HostPort},
+	}}
+	forwarder := NewForwarder(sender, s.channel.GetSubChannel("forwarder"),
+		CircuitBreaker(BreakerOptions{FailureThreshold: 1, OpenDuration: time.Minute, Reroute: true}))
+
+	res, err := forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", []string{"rerouted"},
+		tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Millisecond},
+		})
+	s.NoError(err, "expected the retry to be rerouted to the next owner")
+
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal("correct pinging host", pong.From)
+}
+
+func (s *ForwarderTestSuite) TestScatterRequest() {
+	var pong Pong
+
+	build := func(dest string, keys []string) ([]byte, error) {
+		return Ping{Message: keys[0]}.Bytes(), nil
+	}
+	handleLocal := func(ctx context.Context, keys []string, request []byte) ([]byte, error) {
+		return []byte("local"), nil
+	}
+
+	responses, err := s.forwarder.ScatterRequest(context.Background(),
+		[]string{"reachable", "me", "immediate fail"}, build, handleLocal, "test", "/ping",
+		tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Millisecond},
+		})
+	s.NoError(err)
+	s.Require().Len(responses, 3)
+
+	s.Equal(s.peer.PeerInfo().HostPort, responses[0].Destination)
+	s.Equal([]string{"reachable"}, responses[0].Keys)
+	s.False(responses[0].Local)
+	s.NoError(responses[0].Err)
+	s.NoError(json2.Unmarshal(responses[0].Response, &pong))
+	s.Equal("correct pinging host", pong.From)
+
+	s.Equal([]string{"me"}, responses[1].Keys)
+	s.True(responses[1].Local)
+	s.Equal([]byte("local"), responses[1].Response)
+
+	s.Equal("127.0.0.1:0", responses[2].Destination)
+	s.Error(responses[2].Err, "expected the error of a single destination on its response")
+}
+
+func (s *ForwarderTestSuite) TestScatterRequestDiverged() {
+	var pong Pong
+
+	// both keys are owned by a failing destination, the retry finds them
+	// owned by the peer and the local node
+	sender := &MockSender{}
+	sender.On("WhoAmI").Return("192.0.2.1:1", nil)
+	sender.On("Lookup", "moved").Return("127.0.0.1:0", nil).Once()
+	sender.On("Lookup", "moved").Return(s.peer.PeerInfo().HostPort, nil)
+	sender.On("Lookup", "moved here").Return("127.0.0.1:0", nil).Once()
+	sender.On("Lookup", "moved here").Return("192.0.2.1:1", nil)
+
+	forwarder := NewForwarder(sender, s.channel.GetSubChannel("forwarder"))
+
+	build := func(dest string, keys []string) ([]byte, error) {
+		return Ping{Message: keys[0]}.Bytes(), nil
+	}
+	handleLocal := func(ctx context.Context, keys []string, request []byte) ([]byte, error) {
+		return []byte("local"), nil
+	}
+
+	responses, err := forwarder.ScatterRequest(context.Background(),
+		[]string{"moved", "moved here"}, build, handleLocal, "test", "/ping",
+		tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Millisecond},
+		})
+	s.NoError(err)
+	s.Require().Len(responses, 2, "expected the diverged keys to be regrouped")
+
+	s.Equal(s.peer.PeerInfo().HostPort, responses[0].Destination)
+	s.Equal([]string{"moved"}, responses[0].Keys)
+	s.NoError(responses[0].Err)
+	s.NoError(json2.Unmarshal(responses[0].Response, &pong))
+	s.Equal("correct pinging host", pong.From)
+
+	s.Equal([]string{"moved here"}, responses[1].Keys)
+	s.True(responses[1].Local)
+	s.Equal([]byte("local"), responses[1].Response)
+}
+
+func (s *ForwarderTestSuite) TestScatterRequestLookupError() {
+	build := func(dest string, keys []string) ([]byte, error) {
+		return nil, nil
+	}
+
+	_, err := s.forwarder.ScatterRequest(context.Background(), []string{"reachable", "error"},
+		build, nil, "test", "/ping", tchannel.JSON, nil)
+	s.EqualError(err, "lookup error")
+}
+
+func (s *ForwarderTestSuite) TestInflightLimitRejects() {
+	var ping Ping
+
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"),
+		InflightLimit(LimitOptions{MaxInflightPerDestination: 1}))
+
+	dest, err := s.sender.Lookup("unreachable")
+	s.NoError(err)
+
+	done := make(chan struct{})
+	go func() {
+		forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", nil, tchannel.JSON,
+			&Options{Timeout: 200 * time.Millisecond})
+		close(done)
+	}()
+
+	// wait for the first request to be inflight
+	inflight := func() bool {
+		forwarder.limiter.Lock()
+		defer forwarder.limiter.Unlock()
+		d, ok := forwarder.limiter.destinations[dest]
+		return ok && len(d.slots) > 0
+	}
+	for !inflight() {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err = forwarder.ForwardRequest(ping.Bytes(), dest, "test", "/ping", nil, tchannel.JSON, nil)
+	s.IsType(&InflightLimitError{}, err)
+
+	<-done
+}
+
+// newProxyChannel returns a listening channel that relays calls to /ping and
+// /error with a proxy that uses key to look up the destination, and the
+// forwarder of the proxy. The proxy fails the test when it passes a call to
+// the local handler and local is nil.
+func (s *ForwarderTestSuite) newProxyChannel(key string, local tchannel.Handler,
+	opts ...ForwarderOption) (*tchannel.Channel, *Forwarder) {
+
+	ch, err := tchannel.NewChannel("test", nil)
+	s.Require().NoError(err, "channel must be created successfully")
+	s.Require().NoError(ch.ListenAndServe("127.0.0.1:0"), "channel must listen")
+
+	if local == nil {
+		local = tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+			s.Fail("expected the call to be relayed")
+			call.Response().SendSystemError(errors.New("unexpected local call"))
+		})
+	}
+
+	forwarder := NewForwarder(s.sender, ch.GetSubChannel("forwarder"), opts...)
+	proxy, err := forwarder.NewProxy(func(*tchannel.InboundCall) (string, error) {
+		return key, nil
+	}, local)
+	s.Require().NoError(err)
+
+	ch.GetSubChannel("test").Register(proxy, "/ping")
+	ch.GetSubChannel("test").Register(proxy, "/error")
+	return ch, forwarder
+}
+
+func (s *ForwarderTestSuite) TestProxyRelaysCall() {
+	var pong Pong
+
+	proxyCh, _ := s.newProxyChannel("reachable", nil)
+	defer proxyCh.Close()
+
+	ctx, cancel := json.NewContext(time.Second)
+	defer cancel()
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	err := json.CallPeer(ctx, peer, "test", "/ping", &Ping{Message: "hello"}, &pong)
+	s.NoError(err, "expected the call to be relayed")
+	s.Equal("correct pinging host", pong.From)
+	s.Equal("Hello, world!", pong.Message)
+}
+
+func (s *ForwarderTestSuite) TestProxyMarksCallForwarded() {
+	var pong Pong
+
+	proxyCh, _ := s.newProxyChannel("reachable", nil)
+	defer proxyCh.Close()
+
+	ctx, cancel := json.NewContext(time.Second)
+	defer cancel()
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	err := json.CallPeer(json.WithHeaders(ctx, map[string]string{"hdr1": "val1"}), peer, "test", "/ping",
+		&Ping{}, &pong)
+	s.NoError(err, "expected the call to be relayed")
+	s.Equal("val1", pong.Headers["hdr1"], "expected the headers of the call to be relayed")
+	s.Equal("true", pong.Headers[forwardedHeaderName])
+	s.Equal("1", pong.Headers[hopsHeaderName])
+	s.Equal("192.0.2.1:1", pong.Headers[originHeaderName])
+	s.Equal(forwardedRoutingDelegate, pong.Delegate, "expected the call to be marked as forwarded")
+}
+
+func (s *ForwarderTestSuite) TestProxyRequiresLocalHandler() {
+	forwarder := NewForwarder(s.sender, s.channel.GetSubChannel("forwarder"))
+	_, err := forwarder.NewProxy(ShardKey, nil)
+	s.Equal(ErrNoLocalHandler, err)
+}
+
+// loopLocal is a local handler of a proxy that responds to every call.
+func (s *ForwarderTestSuite) loopLocal() tchannel.Handler {
+	return tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		var arg2, arg3 []byte
+		s.NoError(tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2))
+		s.NoError(tchannel.NewArgReader(call.Arg3Reader()).Read(&arg3))
+
+		s.NoError(tchannel.NewArgWriter(call.Response().Arg2Writer()).Write([]byte("{}")))
+		s.NoError(tchannel.NewArgWriter(call.Response().Arg3Writer()).Write(
+			[]byte(`{"message":"local","from":"me"}`)))
+	})
+}
+
+func (s *ForwarderTestSuite) TestProxyHandlesLoopLocally() {
+	var pong Pong
+
+	proxyCh, forwarder := s.newProxyChannel("reachable", s.loopLocal())
+	defer proxyCh.Close()
+
+	loops := make(chan LoopDetectedEvent, 1)
+	l := &EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("forward.LoopDetectedEvent")).Return().Run(func(args mock.Arguments) {
+		loops <- args.Get(0).(LoopDetectedEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	forwarder.RegisterListener(l)
+
+	ctx, cancel := tchannel.NewContextBuilder(time.Second).
+		SetRoutingDelegate(forwardedRoutingDelegate).Build()
+	defer cancel()
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	err := json.CallPeer(ctx, peer, "test", "/ping", &Ping{}, &pong)
+	s.NoError(err)
+	s.Equal("me", pong.From, "expected the forwarded call to be handled locally")
+
+	select {
+	case event := <-loops:
+		s.Equal("reachable", event.Key)
+		s.NotEmpty(event.Origin)
+		s.Equal(1, event.Hops)
+	case <-time.After(time.Second):
+		s.Fail("expected a loop to be detected")
+	}
+}
+
+func (s *ForwarderTestSuite) TestProxyRejectsLoops() {
+	var pong Pong
+
+	proxyCh, forwarder := s.newProxyChannel("reachable", nil)
+	defer proxyCh.Close()
+
+	proxy, err := forwarder.NewProxy(func(*tchannel.InboundCall) (string, error) {
+		return "reachable", nil
+	}, s.loopLocal(), RejectLoops())
+	s.Require().NoError(err)
+	proxyCh.GetSubChannel("test").Register(proxy, "/ping")
+
+	ctx, cancel := tchannel.NewContextBuilder(time.Second).
+		SetRoutingDelegate(forwardedRoutingDelegate).Build()
+	defer cancel()
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	err = json.CallPeer(ctx, peer, "test", "/ping", &Ping{}, &pong)
+	s.Require().Error(err, "expected the forwarded call to be rejected")
+	s.Contains(err.Error(), "would be relayed again")
+}
+
+func (s *ForwarderTestSuite) TestProxyCircuitBreaker() {
+	var pong Pong
+
+	proxyCh, forwarder := s.newProxyChannel("immediate fail", nil,
+		CircuitBreaker(BreakerOptions{FailureThreshold: 1, OpenDuration: time.Minute}))
+	defer proxyCh.Close()
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	opened := make(chan BreakerStateChangedEvent, 1)
+	l := &EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("forward.BreakerStateChangedEvent")).Return().Run(func(args mock.Arguments) {
+		opened <- args.Get(0).(BreakerStateChangedEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	forwarder.RegisterListener(l)
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	ctx, cancel := json.NewContext(time.Second)
+	err = json.CallPeer(ctx, peer, "test", "/ping", &Ping{}, &pong)
+	cancel()
+	s.Error(err, "expected the call to fail")
+
+	// the outcome is reported after the error was sent to the caller
+	select {
+	case event := <-opened:
+		s.Equal(dest, event.Destination)
+		s.Equal(BreakerOpen, event.NewState, "expected the failed relay to open the circuit")
+	case <-time.After(time.Second):
+		s.Fail("expected the failed relay to open the circuit")
+	}
+
+	ctx, cancel = json.NewContext(time.Second)
+	err = json.CallPeer(ctx, peer, "test", "/ping", &Ping{}, &pong)
+	cancel()
+	s.Error(err, "expected the open circuit to reject the call")
+	s.Contains(err.Error(), ErrCircuitOpen.Error())
+}
+
+func (s *ForwarderTestSuite) TestProxyRelaysApplicationError() {
+	var pong Pong
+
+	proxyCh, _ := s.newProxyChannel("reachable", nil)
+	defer proxyCh.Close()
+
+	ctx, cancel := json.NewContext(time.Second)
+	defer cancel()
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	err := json.CallPeer(ctx, peer, "test", "/error", &Ping{}, &pong)
+	s.Error(err, "expected the application error to be relayed")
+}
+
+func (s *ForwarderTestSuite) TestProxyHandlesLocally() {
+	var pong Pong
+
+	local := tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		var arg2, arg3 []byte
+		s.NoError(tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2))
+		s.NoError(tchannel.NewArgReader(call.Arg3Reader()).Read(&arg3))
+
+		s.NoError(tchannel.NewArgWriter(call.Response().Arg2Writer()).Write([]byte("{}")))
+		s.NoError(tchannel.NewArgWriter(call.Response().Arg3Writer()).Write(
+			[]byte(`{"message":"local","from":"me"}`)))
+	})
+
+	proxyCh, _ := s.newProxyChannel("me", local)
+	defer proxyCh.Close()
+
+	ctx, cancel := json.NewContext(time.Second)
+	defer cancel()
+
+	peer := s.channel.Peers().GetOrAdd(proxyCh.PeerInfo().HostPort)
+	err := json.CallPeer(ctx, peer, "test", "/ping", &Ping{}, &pong)
+	s.NoError(err)
+	s.Equal("me", pong.From, "expected the call to be handled by the local handler")
+}
+
+func (s *ForwarderTestSuite) TestForwardRequestAsync() {
+	var ping Ping
+	var pong Pong
+
+	dest, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+
+	future := s.forwarder.ForwardRequestAsync(context.Background(), ping.Bytes(), dest, "test", "/ping",
+		[]string{"reachable"}, tchannel.JSON, nil)
+
+	res, err := future.Result()
+	s.NoError(err, "expected request to be forwarded")
+	s.NoError(json2.Unmarshal(res, &pong))
+	s.Equal("correct pinging host", pong.From)
+
+	select {
+	case <-future.Done():
+	default:
+		s.Fail("expected the future to be done")
+	}
+}
+
+func (s *ForwarderTestSuite) TestForwardRequestAsyncCancel() {
+	var ping Ping
+
+	dest, err := s.sender.Lookup("immediate fail")
+	s.NoError(err)
+
+	future := s.forwarder.ForwardRequestAsync(context.Background(), ping.Bytes(), dest, "test", "/ping",
+		[]string{"immediate fail"}, tchannel.JSON, &Options{
+			MaxRetries:    1,
+			RetrySchedule: []time.Duration{time.Minute},
+		})
+	future.Cancel()
+
+	_, err = future.Result()
+	s.Equal(context.Canceled, err)
+}
+
+func (s *ForwarderTestSuite) TestAwaitAll() {
+	var ping Ping
+
+	reachable, err := s.sender.Lookup("reachable")
+	s.NoError(err)
+	unreachable, err := s.sender.Lookup("unreachable")
+	s.NoError(err)
+
+	done := s.forwarder.ForwardRequestAsync(context.Background(), ping.Bytes(), reachable, "test",
+		"/ping", []string{"reachable"}, tchannel.JSON, nil)
+	s.NoError(AwaitAll(context.Background(), done, NewCompletedFuture(nil, nil)))
+
+	slow := s.forwarder.ForwardRequestAsync(context.Background(), ping.Bytes(), unreachable, "test",
+		"/ping", []string{"unreachable"}, tchannel.JSON, &Options{Timeout: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s.Equal(context.DeadlineExceeded, AwaitAll(ctx, done, slow))
+
+	_, err = slow.Result()
+	s.Equal(context.Canceled, err, "expected the pending future to be cancelled")
+}
+
 func (s *ForwarderTestSuite) TestRegisterListener() {
 	listener := &EventListener{}
 	listener.On("HandleEvent").Return()
@@ -381,6 +1308,67 @@ func (s *ForwarderTestSuite) TestInvalidInflightDecrement() {
 	wg.Wait()
 }
 
+type recordingSpan struct {
+	id        string
+	operation string
+	parent    tracing.SpanContext
+	tags      map[string]interface{}
+	finished  bool
+}
+
+func (s *recordingSpan) Context() tracing.SpanContext         { return s.id }
+func (s *recordingSpan) SetTag(key string, value interface{}) { s.tags[key] = value }
+func (s *recordingSpan) Finish()                              { s.finished = true }
+
+type recordingTracer struct {
+	sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) StartSpan(operation string, parent tracing.SpanContext) tracing.Span {
+	t.Lock()
+	defer t.Unlock()
+
+	span := &recordingSpan{
+		id:        fmt.Sprintf("span-%d", len(t.spans)),
+		operation: operation,
+		parent:    parent,
+		tags:      make(map[string]interface{}),
+	}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (t *recordingTracer) Inject(sc tracing.SpanContext, headers map[string]string) error {
+	headers["trace-span"] = sc.(string)
+	return nil
+}
+
+func (t *recordingTracer) Extract(headers map[string]string) (tracing.SpanContext, error) {
+	if id, ok := headers["trace-span"]; ok {
+		return id, nil
+	}
+	return nil, nil
+}
+
+// lookupNSenderStub adds LookupN to a Sender so that hedged requests can be
+// sent to the next owner of a key.
+type lookupNSenderStub struct {
+	Sender
+	owners map[string][]string
+}
+
+func (s lookupNSenderStub) Lookup(key string) (string, error) {
+	if owners, ok := s.owners[key]; ok {
+		return owners[0], nil
+	}
+	return s.Sender.Lookup(key)
+}
+
+func (s lookupNSenderStub) LookupN(key string, n int) ([]string, error) {
+	return s.owners[key], nil
+}
+
 func TestForwarderTestSuite(t *testing.T) {
 	suite.Run(t, new(ForwarderTestSuite))
 }
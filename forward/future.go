@@ -0,0 +1,110 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// A Future is the result of a request that is forwarded asynchronously.
+type Future struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	res []byte
+	err error
+}
+
+// NewCompletedFuture returns a Future that has already completed with the
+// given response and error.
+func NewCompletedFuture(res []byte, err error) *Future {
+	f := &Future{
+		done:   make(chan struct{}),
+		cancel: func() {},
+	}
+	f.complete(res, err)
+	return f
+}
+
+func (f *Future) complete(res []byte, err error) {
+	f.res = res
+	f.err = err
+	close(f.done)
+}
+
+// Done returns a channel that is closed when the request has completed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the request to complete and returns its response and
+// error.
+func (f *Future) Result() ([]byte, error) {
+	<-f.done
+	return f.res, f.err
+}
+
+// Cancel aborts the request, including pending retries. A cancelled request
+// completes with context.Canceled unless it already completed before.
+func (f *Future) Cancel() {
+	f.cancel()
+}
+
+// ForwardRequestAsync is like ForwardRequestContext but returns immediately.
+// The request is forwarded in the background and counts towards the inflight
+// requests of the forwarder until it completes; its result is available from
+// the returned Future.
+func (f *Forwarder) ForwardRequestAsync(ctx context.Context, request []byte, destination, service,
+	endpoint string, keys []string, format tchannel.Format, opts *Options) *Future {
+
+	ctx, cancel := context.WithCancel(ctx)
+	future := &Future{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go func() {
+		defer cancel()
+		future.complete(f.ForwardRequestContext(ctx, request, destination, service, endpoint, keys,
+			format, opts))
+	}()
+
+	return future
+}
+
+// AwaitAll waits until all futures have completed or the context is done,
+// which allows a deadline to be shared by many requests. When the context is
+// done first the futures that did not complete yet are cancelled and the
+// error of the context is returned.
+func AwaitAll(ctx context.Context, futures ...*Future) error {
+	for i, future := range futures {
+		select {
+		case <-future.Done():
+		case <-ctx.Done():
+			for _, pending := range futures[i:] {
+				pending.Cancel()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
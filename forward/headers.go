@@ -0,0 +1,163 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+var errHeaderTooLong = errors.New("header too long to encode")
+
+// contextHeaders returns the application headers carried by the context, which
+// are passed on to the destination of a forwarded request.
+func contextHeaders(ctx context.Context) map[string]string {
+	hctx, ok := ctx.(tchannel.ContextWithHeaders)
+	if !ok {
+		return nil
+	}
+	return hctx.Headers()
+}
+
+// mergeHeaders returns a new map with the headers of both maps. Headers in
+// extra replace headers with the same key in base.
+func mergeHeaders(base, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// encodeHeaders encodes the headers into arg2 for the given format. It returns
+// nil when there are no headers or when the format has no known header
+// encoding. The raw format has no header encoding of its own, its headers are
+// encoded as JSON to be read with ContextWithRawHeaders; they are only sent
+// when this is enabled with Options.RawHeaders or the RawHeaders ProxyOption.
+func encodeHeaders(headers map[string]string, format tchannel.Format) ([]byte, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	switch format {
+	case tchannel.JSON, tchannel.Raw:
+		return json.Marshal(headers)
+	case tchannel.Thrift:
+		return encodeThriftHeaders(headers)
+	default:
+		return nil, nil
+	}
+}
+
+// decodeHeaders decodes arg2 for the given format. It returns nil when the
+// format has no known header encoding.
+func decodeHeaders(b []byte, format tchannel.Format) (map[string]string, error) {
+	switch format {
+	case tchannel.JSON:
+		headers := make(map[string]string)
+		if len(b) == 0 {
+			return headers, nil
+		}
+		err := json.Unmarshal(b, &headers)
+		return headers, err
+	case tchannel.Thrift:
+		return decodeThriftHeaders(b)
+	default:
+		return nil, nil
+	}
+}
+
+// encodeThriftHeaders encodes headers the way TChannel Thrift expects them in
+// arg2: the number of headers followed by the key/value pairs, all prefixed by
+// their length as 16 bit big endian integers.
+func encodeThriftHeaders(headers map[string]string) ([]byte, error) {
+	if len(headers) > math.MaxUint16 {
+		return nil, errHeaderTooLong
+	}
+
+	var buffer bytes.Buffer
+	writeLen := func(n int) {
+		binary.Write(&buffer, binary.BigEndian, uint16(n))
+	}
+
+	writeLen(len(headers))
+	for k, v := range headers {
+		if len(k) > math.MaxUint16 || len(v) > math.MaxUint16 {
+			return nil, errHeaderTooLong
+		}
+		writeLen(len(k))
+		buffer.WriteString(k)
+		writeLen(len(v))
+		buffer.WriteString(v)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decodeThriftHeaders is the inverse of encodeThriftHeaders.
+func decodeThriftHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	if len(b) == 0 {
+		return headers, nil
+	}
+
+	reader := bytes.NewReader(b)
+	readString := func() (string, error) {
+		var n uint16
+		if err := binary.Read(reader, binary.BigEndian, &n); err != nil {
+			return "", err
+		}
+		s := make([]byte, n)
+		if _, err := io.ReadFull(reader, s); err != nil {
+			return "", err
+		}
+		return string(s), nil
+	}
+
+	var n uint16
+	if err := binary.Read(reader, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < int(n); i++ {
+		k, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		headers[k] = v
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+)
+
+func TestThriftHeadersRoundTrip(t *testing.T) {
+	headers := map[string]string{"key": "value", "empty": ""}
+
+	b, err := encodeHeaders(headers, tchannel.Thrift)
+	assert.NoError(t, err)
+
+	decoded, err := decodeHeaders(b, tchannel.Thrift)
+	assert.NoError(t, err)
+	assert.Equal(t, headers, decoded)
+}
+
+func TestThriftHeadersEncoding(t *testing.T) {
+	b, err := encodeHeaders(map[string]string{"k": "v"}, tchannel.Thrift)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 0, 1, 'k', 0, 1, 'v'}, b)
+}
+
+func TestDecodeThriftHeadersTruncated(t *testing.T) {
+	_, err := decodeHeaders([]byte{0, 1, 0, 3, 'k'}, tchannel.Thrift)
+	assert.Error(t, err)
+}
+
+func TestEncodeNoHeaders(t *testing.T) {
+	b, err := encodeHeaders(nil, tchannel.JSON)
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+}
+
+func TestMergeHeaders(t *testing.T) {
+	merged := mergeHeaders(map[string]string{"a": "1", "b": "1"}, map[string]string{"b": "2"})
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, merged)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	hopsHeaderName     = "ringpop-hops"
+	originHeaderName   = "ringpop-origin"
+	checksumHeaderName = "ringpop-checksum"
+)
+
+// A checksumSender is a Sender that can also return the checksum of the ring
+// it uses for lookups. Requests forwarded by such a Sender carry the checksum
+// so the receiver can detect that the two nodes disagree on the ring.
+type checksumSender interface {
+	Sender
+
+	// Checksum should return the checksum of the ring of the sender
+	Checksum() (uint32, error)
+}
+
+type rawHeadersKey struct{}
+
+// ContextWithRawHeaders returns a context that carries the headers of a
+// request in the raw format, arg2 as received by the handler. Raw requests
+// forwarded with Options.RawHeaders, or relayed by a Proxy created with the
+// RawHeaders option, carry their forwarding headers JSON encoded in arg2 when
+// no headers are set, which is how they are read back from the context
+// returned here.
+func ContextWithRawHeaders(ctx context.Context, arg2 []byte) context.Context {
+	headers := make(map[string]string)
+	if len(arg2) > 0 {
+		if err := json.Unmarshal(arg2, &headers); err != nil {
+			return ctx
+		}
+	}
+	return context.WithValue(ctx, rawHeadersKey{}, headers)
+}
+
+// requestHeaders returns the headers of the incoming request of the context.
+func requestHeaders(ctx context.Context) map[string]string {
+	if headers, ok := ctx.Value(rawHeadersKey{}).(map[string]string); ok {
+		return headers
+	}
+	return contextHeaders(ctx)
+}
+
+// ForwardedFrom returns the node that first forwarded the incoming request of
+// the context and the number of times it was forwarded since. It returns false
+// when the request was not forwarded by ringpop.
+func ForwardedFrom(ctx context.Context) (origin string, hops int, ok bool) {
+	headers := requestHeaders(ctx)
+	if _, ok := headers[forwardedHeaderName]; !ok {
+		return "", 0, false
+	}
+
+	hops, err := strconv.Atoi(headers[hopsHeaderName])
+	if err != nil || hops < 1 {
+		// forwarded by a node that does not count hops
+		hops = 1
+	}
+
+	return headers[originHeaderName], hops, true
+}
+
+// SenderChecksum returns the ring checksum of the node that forwarded the
+// incoming request of the context. It returns false when the request was not
+// forwarded or the sender did not include its checksum.
+func SenderChecksum(ctx context.Context) (uint32, bool) {
+	headers := requestHeaders(ctx)
+	if _, ok := headers[forwardedHeaderName]; !ok {
+		return 0, false
+	}
+
+	checksum, err := strconv.ParseUint(headers[checksumHeaderName], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(checksum), true
+}
+
+// checksumHeaders returns the header that carries the ring checksum of the
+// sender, or nil when the sender does not know its checksum.
+func checksumHeaders(sender Sender) map[string]string {
+	cs, ok := sender.(checksumSender)
+	if !ok {
+		return nil
+	}
+
+	checksum, err := cs.Checksum()
+	if err != nil {
+		return nil
+	}
+	return map[string]string{
+		checksumHeaderName: strconv.FormatUint(uint64(checksum), 10),
+	}
+}
+
+// forwardHeaders returns the headers that mark a request as forwarded. The
+// hop count and origin of an incoming request that was itself forwarded are
+// carried over.
+func forwardHeaders(ctx context.Context, identity string) map[string]string {
+	origin, hops, ok := ForwardedFrom(ctx)
+	if !ok || origin == "" {
+		origin = identity
+	}
+
+	return map[string]string{
+		forwardedHeaderName: "true",
+		hopsHeaderName:      strconv.Itoa(hops + 1),
+		originHeaderName:    origin,
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/json"
+	"golang.org/x/net/context"
+)
+
+func TestForwardedFromNotForwarded(t *testing.T) {
+	_, _, ok := ForwardedFrom(context.Background())
+	assert.False(t, ok)
+
+	ctx := json.WithHeaders(context.Background(), map[string]string{"key": "value"})
+	_, _, ok = ForwardedFrom(ctx)
+	assert.False(t, ok)
+}
+
+func TestForwardedFromHeaders(t *testing.T) {
+	ctx := json.WithHeaders(context.Background(), map[string]string{
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "2",
+		"ringpop-origin":    "192.0.2.1:1",
+	})
+
+	origin, hops, ok := ForwardedFrom(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.1:1", origin)
+	assert.Equal(t, 2, hops)
+}
+
+func TestForwardedFromWithoutHops(t *testing.T) {
+	ctx := json.WithHeaders(context.Background(), staticForwardHeaders)
+
+	origin, hops, ok := ForwardedFrom(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "", origin)
+	assert.Equal(t, 1, hops, "expected a forwarded request to count as one hop")
+}
+
+func TestForwardedFromRawHeaders(t *testing.T) {
+	arg2, err := encodeHeaders(forwardHeaders(context.Background(), "192.0.2.1:1"), tchannel.Raw)
+	assert.NoError(t, err)
+
+	origin, hops, ok := ForwardedFrom(ContextWithRawHeaders(context.Background(), arg2))
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.1:1", origin)
+	assert.Equal(t, 1, hops)
+
+	_, _, ok = ForwardedFrom(ContextWithRawHeaders(context.Background(), []byte("not json")))
+	assert.False(t, ok)
+}
+
+func TestForwardHeadersCarryOver(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "1",
+		"ringpop-origin":    "192.0.2.1:1",
+	}, forwardHeaders(context.Background(), "192.0.2.1:1"))
+
+	ctx := json.WithHeaders(context.Background(), map[string]string{
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "1",
+		"ringpop-origin":    "192.0.2.1:1",
+	})
+	assert.Equal(t, map[string]string{
+		"ringpop-forwarded": "true",
+		"ringpop-hops":      "2",
+		"ringpop-origin":    "192.0.2.1:1",
+	}, forwardHeaders(ctx, "192.0.2.1:2"))
+}
+
+func TestSenderChecksum(t *testing.T) {
+	_, ok := SenderChecksum(json.WithHeaders(context.Background(), map[string]string{
+		"ringpop-checksum": "1234",
+	}))
+	assert.False(t, ok, "expected no checksum for a request that was not forwarded")
+
+	_, ok = SenderChecksum(json.WithHeaders(context.Background(), staticForwardHeaders))
+	assert.False(t, ok, "expected no checksum when the sender did not send one")
+
+	checksum, ok := SenderChecksum(json.WithHeaders(context.Background(), map[string]string{
+		"ringpop-forwarded": "true",
+		"ringpop-checksum":  "1234",
+	}))
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1234), checksum)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindowSize is the number of recent calls a latencyWindow keeps.
+	latencyWindowSize = 100
+
+	// minLatencySamples is the number of latencies that needs to be recorded
+	// for a destination before percentiles are calculated.
+	minLatencySamples = 20
+)
+
+// A latencySample is the latency of a single call and whether it failed.
+type latencySample struct {
+	latency time.Duration
+	failed  bool
+}
+
+// A latencyWindow holds the latencies of the most recent calls to a single
+// destination, and whether they failed. It is not thread safe.
+type latencyWindow struct {
+	samples []latencySample
+	next    int
+}
+
+// add records the latency of a call, replacing the oldest call when the window
+// is full.
+func (w *latencyWindow) add(latency time.Duration, failed bool) {
+	sample := latencySample{latency, failed}
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, sample)
+		return
+	}
+
+	w.samples[w.next] = sample
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// len returns the number of calls in the window.
+func (w *latencyWindow) len() int {
+	return len(w.samples)
+}
+
+// failures returns the number of failed calls in the window.
+func (w *latencyWindow) failures() int {
+	failures := 0
+	for _, sample := range w.samples {
+		if sample.failed {
+			failures++
+		}
+	}
+	return failures
+}
+
+// percentile returns the p-th percentile, with p between 0 and 1, of the
+// latencies of the calls in the window. It returns zero for an empty window.
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	if len(w.samples) == 0 {
+		return 0
+	}
+
+	latencies := make([]time.Duration, len(w.samples))
+	for i, sample := range w.samples {
+		latencies[i] = sample.latency
+	}
+	sort.Sort(durations(latencies))
+
+	i := int(p*float64(len(latencies))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
+
+// A latencyTracker records the latencies of calls per destination.
+type latencyTracker struct {
+	sync.Mutex
+	windows map[string]*latencyWindow
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		windows: make(map[string]*latencyWindow),
+	}
+}
+
+// record adds the latency of a successful call to the destination.
+func (t *latencyTracker) record(destination string, d time.Duration) {
+	t.add(destination, d, false)
+}
+
+// add adds the latency of a call to the destination and whether it failed.
+func (t *latencyTracker) add(destination string, d time.Duration, failed bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	w, ok := t.windows[destination]
+	if !ok {
+		w = &latencyWindow{}
+		t.windows[destination] = w
+	}
+	w.add(d, failed)
+}
+
+// percentile returns the p-th percentile, with p between 0 and 1, of the
+// recent latencies to the destination. It returns false when not enough
+// latencies have been recorded.
+func (t *latencyTracker) percentile(destination string, p float64) (time.Duration, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	w, ok := t.windows[destination]
+	if !ok || w.len() < minLatencySamples {
+		return 0, false
+	}
+	return w.percentile(p), true
+}
+
+// DestinationStats summarizes the requests recently forwarded to a single
+// destination. The latencies include failed requests.
+type DestinationStats struct {
+	Requests   int
+	Errors     int
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+	LatencyP99 time.Duration
+}
+
+// stats returns the stats of the recent calls to every destination.
+func (t *latencyTracker) stats() map[string]DestinationStats {
+	t.Lock()
+	defer t.Unlock()
+
+	stats := make(map[string]DestinationStats, len(t.windows))
+	for destination, w := range t.windows {
+		stats[destination] = DestinationStats{
+			Requests:   w.len(),
+			Errors:     w.failures(),
+			LatencyP50: w.percentile(0.5),
+			LatencyP95: w.percentile(0.95),
+			LatencyP99: w.percentile(0.99),
+		}
+	}
+	return stats
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
@@ -0,0 +1,105 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyPercentileNeedsSamples(t *testing.T) {
+	tracker := newLatencyTracker()
+	for i := 0; i < minLatencySamples-1; i++ {
+		tracker.record("a", time.Millisecond)
+	}
+
+	_, ok := tracker.percentile("a", 0.95)
+	assert.False(t, ok, "expected no percentile without enough samples")
+
+	_, ok = tracker.percentile("b", 0.95)
+	assert.False(t, ok, "expected no percentile for an unknown destination")
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	tracker := newLatencyTracker()
+	for i := 100; i > 0; i-- {
+		tracker.record("a", time.Duration(i)*time.Millisecond)
+	}
+
+	p95, ok := tracker.percentile("a", 0.95)
+	assert.True(t, ok)
+	assert.Equal(t, 95*time.Millisecond, p95)
+}
+
+func TestLatencyWindowKeepsRecentSamples(t *testing.T) {
+	tracker := newLatencyTracker()
+	for i := 0; i < latencyWindowSize; i++ {
+		tracker.record("a", time.Second)
+	}
+	for i := 0; i < latencyWindowSize; i++ {
+		tracker.record("a", time.Millisecond)
+	}
+
+	p95, ok := tracker.percentile("a", 0.95)
+	assert.True(t, ok)
+	assert.Equal(t, time.Millisecond, p95, "expected old samples to be replaced")
+}
+
+func TestLatencyWindowFailures(t *testing.T) {
+	var w latencyWindow
+	assert.Equal(t, time.Duration(0), w.percentile(0.5), "expected no latency for an empty window")
+
+	for i := 1; i <= 10; i++ {
+		w.add(time.Duration(i)*time.Millisecond, i%5 == 0)
+	}
+
+	assert.Equal(t, 10, w.len())
+	assert.Equal(t, 2, w.failures())
+	assert.Equal(t, 5*time.Millisecond, w.percentile(0.5))
+	assert.Equal(t, 10*time.Millisecond, w.percentile(0.99))
+}
+
+func TestLatencyStats(t *testing.T) {
+	tracker := newLatencyTracker()
+	for i := 1; i <= 10; i++ {
+		tracker.add("a", time.Duration(i)*time.Millisecond, i%5 == 0)
+	}
+	tracker.add("b", time.Second, true)
+
+	assert.Equal(t, map[string]DestinationStats{
+		"a": {
+			Requests:   10,
+			Errors:     2,
+			LatencyP50: 5 * time.Millisecond,
+			LatencyP95: 10 * time.Millisecond,
+			LatencyP99: 10 * time.Millisecond,
+		},
+		"b": {
+			Requests:   1,
+			Errors:     1,
+			LatencyP50: time.Second,
+			LatencyP95: time.Second,
+			LatencyP99: time.Second,
+		},
+	}, tracker.stats())
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"golang.org/x/net/context"
+)
+
+// LimitOptions configure the inflight limits of a forwarder.
+type LimitOptions struct {
+	// MaxInflight is the maximum number of requests that is forwarded at the
+	// same time to all destinations together. Zero means no limit.
+	MaxInflight int
+
+	// MaxInflightPerDestination is the maximum number of requests that is
+	// forwarded at the same time to a single destination. Zero means no
+	// limit.
+	MaxInflightPerDestination int
+
+	// QueueSize is the number of requests that may wait for a free slot when
+	// a limit is reached. When it is zero, requests over the limit are
+	// rejected immediately.
+	QueueSize int
+
+	// QueueTimeout is the maximum time a queued request waits for a free
+	// slot before it is rejected. Zero means it waits until the context of
+	// the request is done.
+	QueueTimeout time.Duration
+}
+
+// An InflightLimitError is returned when a request is rejected because an
+// inflight limit was reached.
+type InflightLimitError struct {
+	// Destination is the destination of the rejected request.
+	Destination string
+
+	// Global is true when the limit on all destinations was reached and false
+	// when the limit of the destination was reached.
+	Global bool
+
+	// Limit is the limit that was reached.
+	Limit int
+}
+
+func (e *InflightLimitError) Error() string {
+	if e.Global {
+		return fmt.Sprintf("inflight limit of %d requests reached", e.Limit)
+	}
+	return fmt.Sprintf("inflight limit of %d requests reached for destination %s", e.Limit, e.Destination)
+}
+
+// A limiter enforces the inflight limits of a forwarder. Slots are taken from
+// buffered channels, a nil channel means there is no limit.
+type limiter struct {
+	opts  LimitOptions
+	clock clock.Clock
+
+	global chan struct{}
+
+	sync.Mutex
+	destinations map[string]*destinationSlots
+	queued       int
+}
+
+// destinationSlots are the slots of a single destination. They are removed
+// from the limiter once no request holds or waits for one of them.
+type destinationSlots struct {
+	slots chan struct{}
+	users int
+}
+
+func newLimiter(opts LimitOptions, c clock.Clock) *limiter {
+	l := &limiter{
+		opts:         opts,
+		clock:        c,
+		destinations: make(map[string]*destinationSlots),
+	}
+	if opts.MaxInflight > 0 {
+		l.global = make(chan struct{}, opts.MaxInflight)
+	}
+	return l
+}
+
+// destination returns the slots of the destination, and a function that is
+// called once the request no longer holds or waits for one of them.
+func (l *limiter) destination(destination string) (chan struct{}, func()) {
+	if l.opts.MaxInflightPerDestination <= 0 {
+		return nil, func() {}
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	d, ok := l.destinations[destination]
+	if !ok {
+		d = &destinationSlots{
+			slots: make(chan struct{}, l.opts.MaxInflightPerDestination),
+		}
+		l.destinations[destination] = d
+	}
+	d.users++
+
+	return d.slots, func() {
+		l.Lock()
+		defer l.Unlock()
+
+		d.users--
+		if d.users == 0 {
+			delete(l.destinations, destination)
+		}
+	}
+}
+
+// acquire takes a slot for a request to the destination, queueing the request
+// when a limit is reached and the queue is not full. The slot of the
+// destination is taken first so that requests queued for a slow destination
+// do not hold on to global slots. The returned function releases the slots.
+func (l *limiter) acquire(ctx context.Context, destination string) (func(), error) {
+	slots, done := l.destination(destination)
+
+	if tryAcquire(slots) {
+		if tryAcquire(l.global) {
+			return func() { release(l.global); release(slots); done() }, nil
+		}
+		release(slots)
+	}
+
+	if l.opts.QueueSize <= 0 {
+		done()
+		return nil, l.limitError(destination, slots)
+	}
+
+	l.Lock()
+	if l.queued >= l.opts.QueueSize {
+		l.Unlock()
+		done()
+		return nil, l.limitError(destination, slots)
+	}
+	l.queued++
+	l.Unlock()
+
+	defer func() {
+		l.Lock()
+		l.queued--
+		l.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if l.opts.QueueTimeout > 0 {
+		timer := l.clock.Timer(l.opts.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	if err := waitAcquire(ctx, slots, timeout); err != nil {
+		done()
+		if err == errQueueTimeout {
+			return nil, l.limitError(destination, slots)
+		}
+		return nil, err
+	}
+
+	if err := waitAcquire(ctx, l.global, timeout); err != nil {
+		release(slots)
+		done()
+		if err == errQueueTimeout {
+			return nil, &InflightLimitError{Destination: destination, Global: true, Limit: l.opts.MaxInflight}
+		}
+		return nil, err
+	}
+
+	return func() { release(l.global); release(slots); done() }, nil
+}
+
+// limitError returns the error for the limit that rejected a request to the
+// destination.
+func (l *limiter) limitError(destination string, slots chan struct{}) error {
+	if slots != nil && len(slots) == cap(slots) {
+		return &InflightLimitError{Destination: destination, Limit: l.opts.MaxInflightPerDestination}
+	}
+	return &InflightLimitError{Destination: destination, Global: true, Limit: l.opts.MaxInflight}
+}
+
+// errQueueTimeout is returned by waitAcquire when the queue timeout expired.
+var errQueueTimeout = errors.New("queue timeout")
+
+func tryAcquire(slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func waitAcquire(ctx context.Context, slots chan struct{}, timeout <-chan time.Time) error {
+	if slots == nil {
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return errQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
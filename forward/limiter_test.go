@@ -0,0 +1,173 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestLimiterRejectsPerDestination(t *testing.T) {
+	l := newLimiter(LimitOptions{MaxInflightPerDestination: 1}, clock.New())
+
+	release, err := l.acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	_, err = l.acquire(context.Background(), "a")
+	assert.Equal(t, &InflightLimitError{Destination: "a", Limit: 1}, err)
+
+	_, err = l.acquire(context.Background(), "b")
+	assert.NoError(t, err, "expected other destinations to have their own limit")
+
+	release()
+	_, err = l.acquire(context.Background(), "a")
+	assert.NoError(t, err, "expected the released slot to be available")
+}
+
+func TestLimiterRejectsGlobal(t *testing.T) {
+	l := newLimiter(LimitOptions{MaxInflight: 1, MaxInflightPerDestination: 1}, clock.New())
+
+	_, err := l.acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	_, err = l.acquire(context.Background(), "b")
+	assert.Equal(t, &InflightLimitError{Destination: "b", Global: true, Limit: 1}, err)
+
+	release, err := l.acquire(context.Background(), "c")
+	assert.Nil(t, release)
+	assert.Error(t, err)
+
+	// the slot of the rejected destination must have been returned
+	l.Lock()
+	_, ok := l.destinations["b"]
+	l.Unlock()
+	assert.False(t, ok, "expected no slot to be held for the rejected destination")
+}
+
+func TestLimiterPrunesIdleDestinations(t *testing.T) {
+	l := newLimiter(LimitOptions{MaxInflightPerDestination: 1}, clock.New())
+
+	releaseA, err := l.acquire(context.Background(), "a")
+	assert.NoError(t, err)
+	releaseB, err := l.acquire(context.Background(), "b")
+	assert.NoError(t, err)
+
+	_, err = l.acquire(context.Background(), "a")
+	assert.Error(t, err)
+
+	releaseA()
+
+	l.Lock()
+	_, a := l.destinations["a"]
+	_, b := l.destinations["b"]
+	l.Unlock()
+	assert.False(t, a, "expected the idle destination to be removed")
+	assert.True(t, b, "expected the busy destination to be kept")
+
+	releaseB()
+	l.Lock()
+	assert.Len(t, l.destinations, 0)
+	l.Unlock()
+
+	_, err = l.acquire(context.Background(), "a")
+	assert.NoError(t, err, "expected a removed destination to get new slots")
+}
+
+func TestLimiterQueues(t *testing.T) {
+	l := newLimiter(LimitOptions{MaxInflight: 1, QueueSize: 1}, clock.New())
+
+	release, err := l.acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.acquire(context.Background(), "b")
+		acquired <- err
+	}()
+
+	// wait for the request to be queued
+	for {
+		l.Lock()
+		queued := l.queued
+		l.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err = l.acquire(context.Background(), "c")
+	assert.Error(t, err, "expected rejection when the queue is full")
+
+	release()
+	assert.NoError(t, <-acquired, "expected the queued request to get the released slot")
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	c := clock.NewMock()
+	l := newLimiter(LimitOptions{MaxInflightPerDestination: 1, QueueSize: 1, QueueTimeout: time.Second}, c)
+
+	_, err := l.acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.acquire(context.Background(), "a")
+		acquired <- err
+	}()
+
+	for {
+		l.Lock()
+		queued := l.queued
+		l.Unlock()
+		if queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Add(time.Second)
+	assert.Equal(t, &InflightLimitError{Destination: "a", Limit: 1}, <-acquired)
+}
+
+func TestLimiterQueueCancelled(t *testing.T) {
+	l := newLimiter(LimitOptions{MaxInflight: 1, QueueSize: 1}, clock.New())
+
+	_, err := l.acquire(context.Background(), "a")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = l.acquire(ctx, "a")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestInflightLimitErrorMessage(t *testing.T) {
+	assert.EqualError(t, &InflightLimitError{Global: true, Limit: 10},
+		"inflight limit of 10 requests reached")
+	assert.EqualError(t, &InflightLimitError{Destination: "a", Limit: 2},
+		"inflight limit of 2 requests reached for destination a")
+}
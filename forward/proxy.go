@@ -0,0 +1,352 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"errors"
+	"io"
+
+	log "github.com/uber-common/bark"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// ErrNoLocalHandler is returned by NewProxy when the handler for calls of keys
+// owned by the local node is missing.
+var ErrNoLocalHandler = errors.New("proxy requires a local handler")
+
+// A KeyFunc returns the key of an inbound call that is used to look up the
+// destination of the call. It must not read the arguments of the call.
+type KeyFunc func(call *tchannel.InboundCall) (string, error)
+
+// ShardKey is a KeyFunc that uses the shard key of the inbound call.
+func ShardKey(call *tchannel.InboundCall) (string, error) {
+	return call.ShardKey(), nil
+}
+
+// A Proxy is a TChannel handler that relays inbound calls to the owner of
+// their key. Arg3 of the call and the response are streamed between the
+// inbound and outbound call fragment by fragment, so the request is never
+// fully held in memory nor deserialized.
+//
+// Only arg2, which holds the headers of the call, is buffered. For the JSON,
+// Thrift and raw formats the headers that mark the call as forwarded are added
+// to it. Relayed calls count towards the inflight limits and circuit breakers
+// of the forwarder, but because arg3 is not buffered they are never retried,
+// hedged or rerouted. Calls for keys owned by the local node are passed to the
+// local handler untouched.
+//
+// Calls that were already forwarded by another node are never relayed again,
+// which prevents them from bouncing between nodes that disagree on the ring.
+// They are recognized by their routing delegate transport header before any
+// argument is read, and are passed to the local handler as well unless the
+// Proxy rejects loops.
+type Proxy struct {
+	forwarder   *Forwarder
+	key         KeyFunc
+	local       tchannel.Handler
+	rejectLoops bool
+	rawHeaders  bool
+	logger      log.Logger
+}
+
+// A ProxyOption configures a Proxy.
+type ProxyOption func(*Proxy)
+
+// RejectLoops makes the Proxy reject calls that were already forwarded by
+// another node and are not owned by the local node either with a bad request
+// error, instead of passing them to the local handler.
+func RejectLoops() ProxyOption {
+	return func(p *Proxy) {
+		p.rejectLoops = true
+	}
+}
+
+// RawHeaders makes the Proxy add the forwarding headers to arg2 of relayed
+// calls in the raw format when arg2 is empty or holds JSON encoded headers, see
+// ContextWithRawHeaders. Without it arg2 of raw calls is relayed as is.
+func RawHeaders() ProxyOption {
+	return func(p *Proxy) {
+		p.rawHeaders = true
+	}
+}
+
+// NewProxy returns a Proxy that relays calls for keys owned by other nodes
+// and passes calls for keys owned by the local node to local. The Proxy can be
+// registered for any number of methods on a SubChannel.
+func (f *Forwarder) NewProxy(key KeyFunc, local tchannel.Handler, opts ...ProxyOption) (*Proxy, error) {
+	if local == nil {
+		return nil, ErrNoLocalHandler
+	}
+
+	p := &Proxy{
+		forwarder: f,
+		key:       key,
+		local:     local,
+		logger:    f.logger,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// Handle implements tchannel.Handler.
+func (p *Proxy) Handle(ctx context.Context, call *tchannel.InboundCall) {
+	key, err := p.key(call)
+	if err != nil {
+		p.sendError(call, err)
+		return
+	}
+
+	destination, err := p.forwarder.sender.Lookup(key)
+	if err != nil {
+		p.sendError(call, err)
+		return
+	}
+
+	if identity, err := p.forwarder.sender.WhoAmI(); err == nil && destination == identity {
+		p.local.Handle(ctx, call)
+		return
+	}
+
+	f := p.forwarder
+
+	if call.RoutingDelegate() == forwardedRoutingDelegate {
+		origin := call.RemotePeer().HostPort
+		f.emit(LoopDetectedEvent{
+			Key:         key,
+			Origin:      origin,
+			Destination: destination,
+			Hops:        1,
+		})
+
+		if p.rejectLoops {
+			p.sendError(call, tchannel.NewSystemError(tchannel.ErrCodeBadRequest,
+				"call for key %q forwarded from %s would be relayed again to %s", key, origin, destination))
+			return
+		}
+		p.local.Handle(ctx, call)
+		return
+	}
+
+	f.emit(RequestForwardedEvent{})
+	startTime := f.clock.Now()
+	err = p.forward(ctx, call, key, destination)
+	duration := f.clock.Now().Sub(startTime)
+	f.stats.add(destination, duration, err != nil)
+
+	if err != nil {
+		p.logger.WithFields(log.Fields{
+			"destination": destination,
+			"service":     call.ServiceName(),
+			"endpoint":    call.MethodString(),
+			"error":       err,
+		}).Warn("unable to relay call")
+		f.emit(FailedEvent{
+			Destination: destination,
+			Service:     call.ServiceName(),
+			Endpoint:    call.MethodString(),
+			Duration:    duration,
+			Attempts:    1,
+		})
+		return
+	}
+
+	f.emit(SuccessEvent{
+		Destination: destination,
+		Service:     call.ServiceName(),
+		Endpoint:    call.MethodString(),
+		Duration:    duration,
+		Attempts:    1,
+	})
+}
+
+// forward marks the call as forwarded and relays it to the destination within
+// the inflight limits and circuit breaker of the destination.
+func (p *Proxy) forward(ctx context.Context, call *tchannel.InboundCall, key, destination string) error {
+	f := p.forwarder
+
+	var arg2 []byte
+	if err := tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+		return p.sendError(call, err)
+	}
+
+	headers := p.relayedHeaders(arg2, call.Format())
+	if headers != nil {
+		identity, _ := f.sender.WhoAmI()
+		hctx := context.WithValue(ctx, rawHeadersKey{}, headers)
+		extra := mergeHeaders(forwardHeaders(hctx, identity), checksumHeaders(f.sender))
+		encoded, err := encodeHeaders(mergeHeaders(headers, extra), call.Format())
+		if err != nil {
+			return p.sendError(call, err)
+		}
+		arg2 = encoded
+	}
+
+	if f.limiter != nil {
+		release, err := f.limiter.acquire(ctx, destination)
+		if err != nil {
+			if limitErr, ok := err.(*InflightLimitError); ok {
+				f.emit(InflightLimitRejectedEvent{
+					Destination: destination,
+					Global:      limitErr.Global,
+				})
+			}
+			return p.sendError(call, err)
+		}
+		defer release()
+	}
+
+	if f.breakers != nil && !f.breakers.allow(destination) {
+		f.emit(BreakerRejectedEvent{Destination: destination})
+		return p.sendError(call, ErrCircuitOpen)
+	}
+
+	f.incrementInflight()
+	responded, err := p.relay(ctx, call, destination, arg2)
+	f.decrementInflight()
+
+	// the outcome is decided before the error is sent, which cancels the
+	// context of the call
+	if f.breakers != nil {
+		outcome := callSucceeded
+		if err != nil {
+			outcome = callFailed
+			if ctx.Err() == context.Canceled {
+				outcome = callAbandoned
+			}
+		}
+		f.breakers.report(destination, outcome)
+	}
+
+	if err != nil && !responded {
+		return p.sendError(call, err)
+	}
+	return err
+}
+
+// relayedHeaders returns the headers in arg2 of a relayed call. It returns nil
+// when the format has no known header encoding, or for a raw call when raw
+// headers are not enabled or arg2 does not hold JSON encoded headers, in which
+// case arg2 is relayed as is.
+func (p *Proxy) relayedHeaders(arg2 []byte, format tchannel.Format) map[string]string {
+	if format == tchannel.Raw {
+		if !p.rawHeaders {
+			return nil
+		}
+		format = tchannel.JSON
+	}
+
+	headers, err := decodeHeaders(arg2, format)
+	if err != nil {
+		return nil
+	}
+	return headers
+}
+
+// relay sends arg2 and streams arg3 of the call to the destination, and
+// streams the response back. It returns whether the response to the caller
+// was started; errors that occur before it was can still be sent to the
+// caller as a system error.
+func (p *Proxy) relay(ctx context.Context, call *tchannel.InboundCall, destination string,
+	arg2 []byte) (bool, error) {
+
+	peer := p.forwarder.channel.Peers().GetOrAdd(destination)
+
+	out, err := peer.BeginCall(ctx, call.ServiceName(), call.MethodString(), &tchannel.CallOptions{
+		Format:          call.Format(),
+		ShardKey:        call.ShardKey(),
+		RoutingDelegate: forwardedRoutingDelegate,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := tchannel.NewArgWriter(out.Arg2Writer()).Write(arg2); err != nil {
+		return false, err
+	}
+	if err := relayArg(out.Arg3Writer, call.Arg3Reader); err != nil {
+		return false, err
+	}
+
+	response := out.Response()
+
+	// the response is only known to be an application error once its first
+	// fragment has been received, which happens when arg2 is read.
+	responseArg2, err := response.Arg2Reader()
+	if err != nil {
+		return false, err
+	}
+
+	if response.ApplicationError() {
+		if err := call.Response().SetApplicationError(); err != nil {
+			responseArg2.Close()
+			return true, err
+		}
+	}
+
+	if err := relayArg(call.Response().Arg2Writer, readerFunc(responseArg2)); err != nil {
+		return true, err
+	}
+	return true, relayArg(call.Response().Arg3Writer, response.Arg3Reader)
+}
+
+func (p *Proxy) sendError(call *tchannel.InboundCall, err error) error {
+	if sendErr := call.Response().SendSystemError(err); sendErr != nil {
+		p.logger.WithField("error", sendErr).Warn("unable to send error to caller")
+	}
+	return err
+}
+
+// readerFunc returns a function that returns an argument reader that has
+// already been opened.
+func readerFunc(r tchannel.ArgReader) func() (tchannel.ArgReader, error) {
+	return func() (tchannel.ArgReader, error) {
+		return r, nil
+	}
+}
+
+// relayArg copies a single argument from reader to writer as it is received.
+func relayArg(writer func() (tchannel.ArgWriter, error), reader func() (tchannel.ArgReader, error)) error {
+	r, err := reader()
+	if err != nil {
+		return err
+	}
+
+	w, err := writer()
+	if err != nil {
+		r.Close()
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		r.Close()
+		w.Close()
+		return err
+	}
+
+	if err := r.Close(); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
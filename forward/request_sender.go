@@ -27,15 +27,17 @@ import (
 
 	"golang.org/x/net/context"
 
+	"github.com/benbjohnson/clock"
 	log "github.com/uber-common/bark"
 	"github.com/uber/ringpop-go/logging"
 	"github.com/uber/ringpop-go/shared"
+	"github.com/uber/ringpop-go/tracing"
 	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/raw"
 )
 
-// errDestinationsDiverged is an error that is returned from AttemptRetry
-// if keys that previously hashed to the same destination diverge.
+// errDestinationsDiverged is the reason of the RetryAbortEvent that is emitted
+// when keys that previously hashed to the same destination diverge.
 var errDestinationsDiverged = errors.New("key destinations have diverged")
 
 // A requestSender is used to send a request to its destination, as defined by the sender's
@@ -45,6 +47,10 @@ type requestSender struct {
 	emitter eventEmitter
 	channel shared.SubChannel
 
+	// ctx is the context of the caller, its deadline bounds the timeout of
+	// every attempt and cancelling it aborts the request and pending retries.
+	ctx context.Context
+
 	request           []byte
 	destination       string
 	service, endpoint string
@@ -55,10 +61,33 @@ type requestSender struct {
 
 	timeout             time.Duration
 	retries, maxRetries int
-	retrySchedule       []time.Duration
+	retryPolicy         RetryPolicy
+	retryable           func(error) bool
 	rerouteRetries      bool
 
-	headers []byte
+	// budget is nil when retries are not limited by a retry budget
+	budget *retryBudget
+	clock  clock.Clock
+
+	hedge      bool
+	hedgeDelay time.Duration
+	latencies  *latencyTracker
+
+	// breakers is nil when circuit breaking is disabled
+	breakers *breakers
+
+	// departures interrupts attempts whose destination leaves the ring, it is
+	// nil when the sender does not follow the ring
+	departures *departures
+
+	headers    []byte
+	rawHeaders bool
+
+	// tracer creates a span for every attempt as a child of span, which
+	// covers the forwarded request as a whole.
+	tracer   tracing.Tracer
+	span     tracing.Span
+	rerouted bool
 
 	startTime, retryStartTime time.Time
 
@@ -66,18 +95,30 @@ type requestSender struct {
 }
 
 // NewRequestSender returns a new request sender that can be used to forward a request to its destination
-func newRequestSender(sender Sender, emitter eventEmitter, channel shared.SubChannel, request []byte, keys []string,
-	destination, service, endpoint string, format tchannel.Format, opts *Options) *requestSender {
+func newRequestSender(ctx context.Context, sender Sender, emitter eventEmitter, channel shared.SubChannel,
+	request []byte, keys []string, destination, service, endpoint string, format tchannel.Format,
+	opts *Options) *requestSender {
 
 	logger := logging.Logger("sender")
 	if identity, err := sender.WhoAmI(); err != nil {
 		logger = logger.WithField("local", identity)
 	}
 
+	retryPolicy := opts.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = StaticRetryPolicy(opts.RetrySchedule)
+	}
+
+	retryable := opts.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
 	return &requestSender{
 		sender:         sender,
 		emitter:        emitter,
 		channel:        channel,
+		ctx:            ctx,
 		request:        request,
 		keys:           keys,
 		destination:    destination,
@@ -86,31 +127,81 @@ func newRequestSender(sender Sender, emitter eventEmitter, channel shared.SubCha
 		format:         format,
 		timeout:        opts.Timeout,
 		maxRetries:     opts.MaxRetries,
-		retrySchedule:  opts.RetrySchedule,
+		retryPolicy:    retryPolicy,
+		retryable:      retryable,
 		rerouteRetries: opts.RerouteRetries,
+		hedge:          opts.Hedge,
+		hedgeDelay:     opts.HedgeDelay,
 		headers:        opts.Headers,
+		rawHeaders:     opts.RawHeaders,
+		tracer:         tracing.NoopTracer{},
+		span:           tracing.NoopTracer{}.StartSpan(spanForward, nil),
+		clock:          clock.New(),
 		logger:         logger,
 	}
 }
 
 func (s *requestSender) Send() (res []byte, err error) {
-	ctx, cancel := shared.NewTChannelContext(s.timeout)
+	if s.startTime.IsZero() {
+		s.startTime = s.clock.Now()
+	}
+
+	timeout, err := s.attemptTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCircuit(); err != nil {
+		return nil, err
+	}
+
+	span := s.startAttemptSpan()
+
+	headers, err := s.callHeaders(span)
+	if err != nil {
+		if s.breakers != nil {
+			// the call is not made, give back the probe the circuit allowed
+			s.breakers.report(s.destination, callAbandoned)
+		}
+		finishSpan(span, err)
+		return nil, err
+	}
+
+	ctx, cancel := shared.NewTChannelContext(timeout)
 	defer cancel()
 
-	var forwardError, applicationError error
+	departed, stopWatching := s.watchDestination()
+	defer stopWatching()
 
 	select {
-	case <-s.MakeCall(ctx, &res, &forwardError, &applicationError):
-		if applicationError != nil {
-			return nil, applicationError
+	case result := <-s.call(ctx, timeout, headers):
+		if result.appError != nil {
+			result.appError.RequestInfo = s.info()
+			finishSpan(span, result.appError)
+			return nil, result.appError
 		}
 
-		if forwardError == nil {
+		if result.fwdError != nil && expired(ctx) {
+			// the call failed because the attempt ran out of time, tchannel
+			// may report this before the context is done
+			return s.timedOut(span)
+		}
+
+		finishSpan(span, result.fwdError)
+
+		if result.fwdError == nil {
 			if s.retries > 0 {
 				// forwarding succeeded after retries
 				s.emitter.emit(RetrySuccessEvent{s.retries})
 			}
-			return res, nil
+			return result.res, nil
+		}
+
+		if !s.retryable(result.fwdError) {
+			return nil, &UnreachableError{
+				RequestInfo: s.info(),
+				Err:         result.fwdError,
+			}
 		}
 
 		if s.retries < s.maxRetries {
@@ -128,95 +219,433 @@ func (s *requestSender) Send() (res []byte, err error) {
 
 		s.emitter.emit(MaxRetriesEvent{s.maxRetries})
 
-		return nil, errors.New("max retries exceeded")
+		return nil, &MaxRetriesError{
+			RequestInfo: s.info(),
+			MaxRetries:  s.maxRetries,
+			Err:         result.fwdError,
+		}
 	case <-ctx.Done(): // request timed out
+		return s.timedOut(span)
+	case <-s.ctx.Done(): // caller gave up on the request
+		finishSpan(span, s.ctx.Err())
+		return nil, s.ctx.Err()
+	case <-departed: // destination was removed from the ring
+		cancel()
+		finishSpan(span, errDestinationRemoved)
 
-		identity, _ := s.sender.WhoAmI()
+		s.emitter.emit(DestinationRemovedEvent{Destination: s.destination})
 
-		s.logger.WithFields(log.Fields{
-			"local":       identity,
-			"destination": s.destination,
-			"service":     s.service,
-			"endpoint":    s.endpoint,
-		}).Warn("request timed out")
+		if s.retries < s.maxRetries {
+			return s.AttemptRetry()
+		}
 
-		return nil, errors.New("request timed out")
+		s.emitter.emit(MaxRetriesEvent{s.maxRetries})
+
+		return nil, &MaxRetriesError{
+			RequestInfo: s.info(),
+			MaxRetries:  s.maxRetries,
+			Err:         errDestinationRemoved,
+		}
 	}
 }
 
-// calls remote service and writes response to s.response
-func (s *requestSender) MakeCall(ctx context.Context, res *[]byte, fwdError *error, appError *error) <-chan bool {
-	done := make(chan bool, 1)
-	go func() {
-		defer close(done)
+// timedOut finishes an attempt that ran out of time.
+func (s *requestSender) timedOut(span tracing.Span) ([]byte, error) {
+	finishSpan(span, context.DeadlineExceeded)
+
+	identity, _ := s.sender.WhoAmI()
+
+	s.logger.WithFields(log.Fields{
+		"local":       identity,
+		"destination": s.destination,
+		"service":     s.service,
+		"endpoint":    s.endpoint,
+	}).Warn("request timed out")
+
+	return nil, &TimeoutError{RequestInfo: s.info()}
+}
+
+// expired returns whether the deadline of the context has passed.
+func expired(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// watchDestination returns a channel that is closed when the destination of
+// the attempt is removed from the ring. Only requests that are rerouted on
+// retries are interrupted; they are retried right away, without waiting for
+// the retry delay or withdrawing from the retry budget, because the attempt
+// did not fail due to load on the destination.
+func (s *requestSender) watchDestination() (<-chan struct{}, func()) {
+	if !s.rerouteRetries || s.departures == nil {
+		return nil, func() {}
+	}
+	return s.departures.watch(s.destination)
+}
+
+// info returns the details of the request for an error.
+func (s *requestSender) info() RequestInfo {
+	info := RequestInfo{
+		Destination: s.destination,
+		Keys:        s.keys,
+		Attempts:    s.retries + 1,
+	}
+	if !s.startTime.IsZero() {
+		info.Elapsed = s.clock.Now().Sub(s.startTime)
+	}
+	return info
+}
+
+// startAttemptSpan starts the span for a single attempt to send the request.
+func (s *requestSender) startAttemptSpan() tracing.Span {
+	operation := spanAttempt
+	switch {
+	case s.rerouted:
+		operation = spanReroute
+	case s.retries > 0:
+		operation = spanRetry
+	}
+	s.rerouted = false
+
+	span := s.tracer.StartSpan(operation, s.span.Context())
+	span.SetTag(tagDestination, s.destination)
+	span.SetTag(tagAttempt, s.retries+1)
+	return span
+}
+
+// callHeaders returns arg2 for an attempt. The headers of the request, or when
+// they are not set the headers carried by the context of the caller, are sent
+// along with the span of the attempt, the headers that mark the request as
+// forwarded and the ring checksum of the sender when it is known. Headers of
+// the raw format are sent as is because they cannot be merged; without
+// headers, the headers of a raw request are only JSON encoded when rawHeaders
+// is set.
+func (s *requestSender) callHeaders(span tracing.Span) ([]byte, error) {
+	if s.format == tchannel.Raw && (s.headers != nil || !s.rawHeaders) {
+		return s.headers, nil
+	}
 
-		peer := s.channel.Peers().GetOrAdd(s.destination)
+	spanHeaders := make(map[string]string)
+	if err := s.tracer.Inject(span.Context(), spanHeaders); err != nil {
+		s.logger.WithField("error", err).Warn("unable to inject span into headers")
+		spanHeaders = nil
+	}
+
+	identity, _ := s.sender.WhoAmI()
+	extra := mergeHeaders(spanHeaders, forwardHeaders(s.ctx, identity))
+	extra = mergeHeaders(extra, checksumHeaders(s.sender))
+
+	if s.headers == nil {
+		return encodeHeaders(mergeHeaders(contextHeaders(s.ctx), extra), s.format)
+	}
+
+	headers, err := decodeHeaders(s.headers, s.format)
+	if err != nil || headers == nil {
+		return s.headers, nil
+	}
+
+	return encodeHeaders(mergeHeaders(headers, extra), s.format)
+}
+
+// attemptTimeout returns the timeout for a single attempt, which is the
+// configured timeout limited by the deadline of the caller's context.
+func (s *requestSender) attemptTimeout() (time.Duration, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	deadline, ok := s.ctx.Deadline()
+	if !ok {
+		return s.timeout, nil
+	}
+
+	remaining := deadline.Sub(time.Now())
+	if remaining <= 0 {
+		return 0, context.DeadlineExceeded
+	}
+
+	if remaining < s.timeout {
+		return remaining, nil
+	}
+	return s.timeout, nil
+}
+
+// A callResult is the outcome of a single call to a destination.
+type callResult struct {
+	destination string
+	res         []byte
+	fwdError    error
+	appError    *ApplicationError
+}
 
-		call, err := peer.BeginCall(ctx, s.service, s.endpoint, &tchannel.CallOptions{
-			Format: s.format,
+// call sends the request to its destination. When hedging is enabled and the
+// destination did not respond within the hedge delay, a duplicate request is
+// sent to the next owner of the keys and the first response is returned.
+func (s *requestSender) call(ctx context.Context, timeout time.Duration, headers []byte) <-chan callResult {
+	delay, ok := s.hedgeAfter()
+	if !ok || delay >= timeout {
+		return s.MakeCall(ctx, s.destination, headers)
+	}
+
+	out := make(chan callResult, 1)
+	go s.hedgedCall(ctx, timeout, delay, headers, out)
+	return out
+}
+
+// hedgedCall races the call to the destination with a call to the next owner
+// that is started after delay. The first response is written to out and the
+// other call is cancelled; when both calls fail the last error is written.
+// Nothing is written when ctx is done first.
+func (s *requestSender) hedgedCall(ctx context.Context, timeout, delay time.Duration, headers []byte,
+	out chan<- callResult) {
+
+	primaryCtx, cancelPrimary := shared.NewTChannelContext(timeout)
+	defer cancelPrimary()
+	primary := s.MakeCall(primaryCtx, s.destination, headers)
+
+	select {
+	case result := <-primary:
+		out <- result
+		return
+	case <-ctx.Done():
+		return
+	case <-s.clock.After(delay):
+	}
+
+	hedgeDestination, ok := s.nextOwner()
+	if ok && s.breakers != nil {
+		ok = s.breakers.allow(hedgeDestination)
+	}
+	if !ok {
+		select {
+		case result := <-primary:
+			out <- result
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	s.emitter.emit(HedgeSentEvent{
+		Destination:      s.destination,
+		HedgeDestination: hedgeDestination,
+		Delay:            delay,
+	})
+
+	hedgeCtx, cancelHedge := shared.NewTChannelContext(timeout - delay)
+	defer cancelHedge()
+	hedge := s.MakeCall(hedgeCtx, hedgeDestination, headers)
+
+	var result callResult
+	for pending := 2; pending > 0; pending-- {
+		select {
+		case result = <-primary:
+			primary = nil
+		case result = <-hedge:
+			hedge = nil
+		case <-ctx.Done():
+			return
+		}
+
+		if result.fwdError == nil {
+			break
+		}
+	}
+
+	if result.fwdError == nil && result.destination == hedgeDestination {
+		s.emitter.emit(HedgeWonEvent{
+			Destination:      s.destination,
+			HedgeDestination: hedgeDestination,
 		})
+	}
+
+	out <- result
+}
+
+// hedgeAfter returns the time to wait for a response from the destination
+// before a hedged request is sent, it returns false when no hedged request
+// should be sent.
+func (s *requestSender) hedgeAfter() (time.Duration, bool) {
+	if !s.hedge {
+		return 0, false
+	}
+
+	if s.hedgeDelay > 0 {
+		return s.hedgeDelay, true
+	}
+
+	if s.latencies == nil {
+		return 0, false
+	}
+
+	return s.latencies.percentile(s.destination, 0.95)
+}
+
+// nextOwner returns the next owner of the keys after the destination. It
+// returns false when the sender cannot lookup multiple owners or when the
+// keys do not share the same next owner.
+func (s *requestSender) nextOwner() (string, bool) {
+	sender, ok := s.sender.(lookupNSender)
+	if !ok {
+		return "", false
+	}
+
+	var hedgeDestination string
+	for _, key := range s.keys {
+		dests, err := sender.LookupN(key, 2)
 		if err != nil {
-			*fwdError = err
-			done <- true
-			return
+			return "", false
 		}
 
-		var arg3 []byte
-		headers := s.headers
-		if s.format == tchannel.Thrift {
-			if headers == nil {
-				headers = []byte{0, 0}
+		next := ""
+		for _, dest := range dests {
+			if dest != s.destination {
+				next = dest
+				break
 			}
-			_, arg3, _, err = raw.WriteArgs(call, headers, s.request)
-		} else {
-			var resp *tchannel.OutboundCallResponse
-			_, arg3, resp, err = raw.WriteArgs(call, headers, s.request)
-
-			// check if the response is an application level error
-			if err == nil && resp.ApplicationError() {
-				// parse the json from the application level error
-				errResp := struct {
-					Type    string `json:"type"`
-					Message string `json:"message"`
-				}{}
-
-				err = json.Unmarshal(arg3, &errResp)
-
-				// if parsing succeeded return the error as an application error
-				if err == nil {
-					*appError = errors.New(errResp.Message)
-					done <- true
-					return
+		}
+
+		if next == "" || (hedgeDestination != "" && next != hedgeDestination) {
+			return "", false
+		}
+		hedgeDestination = next
+	}
+
+	return hedgeDestination, hedgeDestination != ""
+}
+
+// checkCircuit checks the circuit breaker of the destination before an
+// attempt. When the circuit is open the request is rerouted to the next owner
+// of the keys if that is enabled, otherwise ErrCircuitOpen is returned.
+func (s *requestSender) checkCircuit() error {
+	if s.breakers == nil || s.breakers.allow(s.destination) {
+		return nil
+	}
+
+	if s.breakers.opts.Reroute {
+		if next, ok := s.nextOwner(); ok && s.breakers.allow(next) {
+			s.emitter.emit(BreakerRerouteEvent{
+				OldDestination: s.destination,
+				NewDestination: next,
+			})
+			s.destination = next
+			s.rerouted = true
+			return nil
+		}
+	}
+
+	s.emitter.emit(BreakerRejectedEvent{Destination: s.destination})
+	return ErrCircuitOpen
+}
+
+// MakeCall calls the remote service on the destination and sends the result
+// on the returned channel. The latency of calls that did not fail to forward
+// is recorded for the destination, and the outcome is reported to its circuit
+// breaker.
+func (s *requestSender) MakeCall(ctx context.Context, destination string, headers []byte) <-chan callResult {
+	done := make(chan callResult, 1)
+	go func() {
+		defer close(done)
+
+		start := time.Now()
+		result := s.makeCall(ctx, destination, headers)
+		if result.fwdError == nil && s.latencies != nil {
+			s.latencies.record(destination, time.Now().Sub(start))
+		}
+
+		if s.breakers != nil {
+			outcome := callSucceeded
+			if result.fwdError != nil {
+				outcome = callFailed
+				if ctx.Err() == context.Canceled {
+					outcome = callAbandoned
 				}
 			}
-		}
-		if err != nil {
-			*fwdError = err
-			done <- true
-			return
+			s.breakers.report(destination, outcome)
 		}
 
-		*res = arg3
-		done <- true
+		done <- result
 	}()
 
 	return done
 }
 
+func (s *requestSender) makeCall(ctx context.Context, destination string, headers []byte) callResult {
+	result := callResult{destination: destination}
+
+	peer := s.channel.Peers().GetOrAdd(destination)
+
+	call, err := peer.BeginCall(ctx, s.service, s.endpoint, &tchannel.CallOptions{
+		Format:          s.format,
+		RoutingDelegate: forwardedRoutingDelegate,
+	})
+	if err != nil {
+		result.fwdError = err
+		return result
+	}
+
+	var arg3 []byte
+	if s.format == tchannel.Thrift {
+		if headers == nil {
+			headers = []byte{0, 0}
+		}
+		_, arg3, _, err = raw.WriteArgs(call, headers, s.request)
+	} else {
+		var resp *tchannel.OutboundCallResponse
+		_, arg3, resp, err = raw.WriteArgs(call, headers, s.request)
+
+		// check if the response is an application level error
+		if err == nil && resp.ApplicationError() {
+			// parse the json from the application level error
+			errResp := struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			}{}
+
+			err = json.Unmarshal(arg3, &errResp)
+
+			// if parsing succeeded return the error as an application error
+			if err == nil {
+				result.appError = &ApplicationError{
+					Type:    errResp.Type,
+					Message: errResp.Message,
+				}
+				return result
+			}
+		}
+	}
+	if err != nil {
+		result.fwdError = err
+		return result
+	}
+
+	result.res = arg3
+	return result
+}
+
 func (s *requestSender) ScheduleRetry() ([]byte, error) {
 	if s.retries == 0 {
-		s.retryStartTime = time.Now()
+		s.retryStartTime = s.clock.Now()
 	}
 
-	time.Sleep(s.retrySchedule[s.retries])
+	if s.budget != nil && !s.budget.withdraw() {
+		s.emitter.emit(RetryBudgetExhaustedEvent{})
+		return nil, ErrRetryBudgetExhausted
+	}
+
+	select {
+	case <-s.clock.After(s.retryPolicy.Delay(s.retries + 1)):
+	case <-s.ctx.Done():
+		s.emitter.emit(RetryAbortEvent{s.ctx.Err().Error()})
+		return nil, s.ctx.Err()
+	}
 
 	return s.AttemptRetry()
 }
 
 // AttemptRetry attempts to resend a request. Before resending it will
 // lookup the keys provided to the requestSender upon construction. If
-// keys that previously hashed to the same destination diverge, an
-// errDestinationsDiverged error will be returned. If keys do not diverge,
+// keys that previously hashed to the same destination diverge, a
+// *DivergedError will be returned. If keys do not diverge,
 // the will be rerouted to their new destination. Rerouting can be disabled
 // by toggling the rerouteRetries flag.
 func (s *requestSender) AttemptRetry() ([]byte, error) {
@@ -227,7 +656,10 @@ func (s *requestSender) AttemptRetry() ([]byte, error) {
 	dests := s.LookupKeys(s.keys)
 	if len(dests) != 1 {
 		s.emitter.emit(RetryAbortEvent{errDestinationsDiverged.Error()})
-		return nil, errDestinationsDiverged
+		return nil, &DivergedError{
+			RequestInfo:  s.info(),
+			Destinations: dests,
+		}
 	}
 
 	if s.rerouteRetries {
@@ -249,6 +681,7 @@ func (s *requestSender) RerouteRetry(destination string) ([]byte, error) {
 	})
 
 	s.destination = destination // update request destination
+	s.rerouted = true
 
 	return s.Send()
 }
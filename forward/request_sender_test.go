@@ -21,11 +21,16 @@
 package forward
 
 import (
+	"strings"
+	"testing"
+	"time"
+
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"github.com/uber/ringpop-go/shared"
 	"github.com/uber/tchannel-go"
-	"testing"
+	"github.com/uber/tchannel-go/json"
+	"golang.org/x/net/context"
 )
 
 type requestSenderTestSuite struct {
@@ -50,7 +55,7 @@ func (s *requestSenderTestSuite) SetupTest() {
 	mockSender := &MockSender{}
 	mockSender.On("WhoAmI").Return("", nil)
 	dummies := s.newDummies(mockSender)
-	s.requestSender = newRequestSender(mockSender, dummies.emitter,
+	s.requestSender = newRequestSender(context.Background(), mockSender, dummies.emitter,
 		dummies.channel, dummies.request, dummies.keys, dummies.dest,
 		dummies.service, dummies.endpoint, dummies.format, dummies.options)
 	s.mockSender = mockSender
@@ -94,7 +99,8 @@ func (s *requestSenderTestSuite) TestAttemptRetrySendsMultipleKeys() {
 	s.requestSender.keys = []string{"key1", "key2"}
 
 	_, err := s.requestSender.AttemptRetry()
-	s.NotEqual(errDestinationsDiverged, err, "not a diverged error")
+	_, diverged := err.(*DivergedError)
+	s.False(diverged, "not a diverged error")
 }
 
 func (s *requestSenderTestSuite) TestLookupKeysDedupes() {
@@ -109,6 +115,24 @@ func (s *requestSenderTestSuite) TestLookupKeysDedupes() {
 	s.Len(dests, 2, "dedupes multiple destinations for multiple keys")
 }
 
+func (s *requestSenderTestSuite) TestHeaderErrorReleasesProbe() {
+	b, c, _ := newTestBreakers()
+	b.report("dummydest", callFailed)
+	b.report("dummydest", callFailed)
+	c.Add(time.Second)
+
+	// a header that is too long to encode fails the request before the call
+	s.requestSender.breakers = b
+	s.requestSender.ctx = json.WithHeaders(context.Background(), map[string]string{
+		"header": strings.Repeat("a", 1<<16),
+	})
+
+	_, err := s.requestSender.Send()
+	s.Equal(errHeaderTooLong, err)
+	s.Equal(BreakerHalfOpen, b.state("dummydest"))
+	s.True(b.allow("dummydest"), "expected the probe to be released")
+}
+
 func TestRequestSenderTestSuite(t *testing.T) {
 	suite.Run(t, new(requestSenderTestSuite))
 }
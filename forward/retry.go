@@ -0,0 +1,173 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// ErrRetryBudgetExhausted is returned when a request is not retried because
+// the retry budget of the forwarder is exhausted.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// A RetryPolicy determines the delay before every retry of a forwarded
+// request.
+type RetryPolicy interface {
+	// Delay returns the delay before the given retry, the first retry is 1.
+	Delay(retry int) time.Duration
+}
+
+// StaticRetryPolicy retries after fixed delays. Retries beyond the end of the
+// schedule use its last delay.
+type StaticRetryPolicy []time.Duration
+
+// Delay implements RetryPolicy.
+func (p StaticRetryPolicy) Delay(retry int) time.Duration {
+	if len(p) == 0 {
+		return 0
+	}
+	if retry > len(p) {
+		retry = len(p)
+	}
+	if retry < 1 {
+		retry = 1
+	}
+	return p[retry-1]
+}
+
+// ExponentialRetryPolicy retries after delays that grow exponentially, with
+// random jitter so that retries of many requests are spread out.
+type ExponentialRetryPolicy struct {
+	// Initial is the delay before the first retry.
+	Initial time.Duration
+
+	// Max caps the delay. Zero means no cap.
+	Max time.Duration
+
+	// Multiplier is the factor by which the delay grows for every retry. It
+	// defaults to 2.
+	Multiplier float64
+
+	// Jitter is the fraction, between 0 and 1, by which every delay is
+	// randomly reduced.
+	Jitter float64
+}
+
+// Delay implements RetryPolicy.
+func (p ExponentialRetryPolicy) Delay(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	if retry < 1 {
+		retry = 1
+	}
+
+	delay := float64(p.Initial) * math.Pow(multiplier, float64(retry-1))
+	if p.Max > 0 && delay > float64(p.Max) {
+		delay = float64(p.Max)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay -= delay * jitter * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+// RetryBudgetOptions configure the retry budget of a forwarder.
+type RetryBudgetOptions struct {
+	// Ratio is the number of retries that is allowed per forwarded request,
+	// for example 0.2 allows retries for up to 20% of the requests.
+	Ratio float64
+
+	// Burst is the number of retries that can be made before any requests
+	// have been forwarded, and the maximum number of retries that can be saved
+	// up. It defaults to 10.
+	Burst int
+}
+
+// A retryBudget is a token bucket that is filled by forwarded requests and
+// emptied by retries.
+type retryBudget struct {
+	sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func newRetryBudget(opts RetryBudgetOptions) *retryBudget {
+	burst := opts.Burst
+	if burst <= 0 {
+		burst = 10
+	}
+
+	return &retryBudget{
+		ratio:  opts.Ratio,
+		max:    float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// deposit adds the share of a forwarded request to the budget.
+func (b *retryBudget) deposit() {
+	b.Lock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+	b.Unlock()
+}
+
+// withdraw takes a retry from the budget, it returns false when the budget is
+// exhausted.
+func (b *retryBudget) withdraw() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// IsRetryable is the default classification of errors of forwarded calls. A
+// call is not retried when the caller gave up or when the destination
+// rejected the call as invalid, which a retry cannot change. Application
+// errors are never retried.
+func IsRetryable(err error) bool {
+	if err == context.Canceled {
+		return false
+	}
+
+	switch tchannel.GetSystemErrorCode(err) {
+	case tchannel.ErrCodeBadRequest, tchannel.ErrCodeCancelled:
+		return false
+	}
+
+	return true
+}
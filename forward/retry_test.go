@@ -0,0 +1,80 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+func TestStaticRetryPolicy(t *testing.T) {
+	p := StaticRetryPolicy{time.Second, 2 * time.Second}
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, 2*time.Second, p.Delay(2))
+	assert.Equal(t, 2*time.Second, p.Delay(3), "expected the last delay beyond the schedule")
+	assert.Equal(t, time.Duration(0), StaticRetryPolicy(nil).Delay(1))
+}
+
+func TestExponentialRetryPolicy(t *testing.T) {
+	p := ExponentialRetryPolicy{Initial: time.Second, Max: 5 * time.Second}
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, 2*time.Second, p.Delay(2))
+	assert.Equal(t, 4*time.Second, p.Delay(3))
+	assert.Equal(t, 5*time.Second, p.Delay(4), "expected the delay to be capped")
+}
+
+func TestExponentialRetryPolicyJitter(t *testing.T) {
+	p := ExponentialRetryPolicy{Initial: time.Second, Multiplier: 3, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := p.Delay(2)
+		assert.True(t, delay > 1500*time.Millisecond && delay <= 3*time.Second,
+			"expected the delay to be reduced by at most half")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(RetryBudgetOptions{Ratio: 0.5, Burst: 1})
+	assert.True(t, b.withdraw(), "expected the burst to be available")
+	assert.False(t, b.withdraw())
+
+	b.deposit()
+	assert.False(t, b.withdraw(), "expected half a retry per request")
+	b.deposit()
+	assert.True(t, b.withdraw())
+
+	for i := 0; i < 10; i++ {
+		b.deposit()
+	}
+	assert.True(t, b.withdraw())
+	assert.False(t, b.withdraw(), "expected saved up retries to be capped by the burst")
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(errors.New("network error")))
+	assert.True(t, IsRetryable(tchannel.ErrTimeout))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "bad request")))
+}
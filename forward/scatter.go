@@ -0,0 +1,161 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"sync"
+
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// A RequestBuilder builds the request for the keys that are owned by a single
+// destination.
+type RequestBuilder func(destination string, keys []string) ([]byte, error)
+
+// A LocalHandler handles the request for the keys that are owned by the local
+// node in-process.
+type LocalHandler func(ctx context.Context, keys []string, request []byte) ([]byte, error)
+
+// A ScatterResponse is the result of the request to a single destination of a
+// scattered request.
+type ScatterResponse struct {
+	Destination string
+	Keys        []string
+
+	// Local is true for the keys that are owned by the local node.
+	Local bool
+
+	Request  []byte
+	Response []byte
+	Err      error
+}
+
+// ScatterRequest groups the keys by their owner, builds a request for every
+// owner and forwards the requests in parallel. Every request is retried on its
+// own. When the keys of a retried request no longer share an owner, they are
+// grouped by their new owners and scattered once more; if they diverge again
+// the *DivergedError is set on the response.
+//
+// The request for the keys owned by the local node is handled in-process by
+// handleLocal. When handleLocal is nil the local request is not handled but
+// returned with Local set, for the caller to handle.
+//
+// The responses are returned in the order in which their destinations first
+// appear in keys, the responses of regrouped keys take the place of the
+// diverged response. An error is only returned when the keys cannot be looked
+// up, errors of single destinations are set on their response.
+func (f *Forwarder) ScatterRequest(ctx context.Context, keys []string, build RequestBuilder,
+	handleLocal LocalHandler, service, endpoint string, format tchannel.Format,
+	opts *Options) ([]ScatterResponse, error) {
+
+	identity, err := f.sender.WhoAmI()
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := f.groupKeys(keys, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	f.scatter(ctx, responses, build, handleLocal, service, endpoint, format, opts)
+
+	var scattered []ScatterResponse
+	for _, r := range responses {
+		if _, diverged := r.Err.(*DivergedError); !diverged {
+			scattered = append(scattered, r)
+			continue
+		}
+
+		regrouped, err := f.groupKeys(r.Keys, identity)
+		if err != nil {
+			scattered = append(scattered, r)
+			continue
+		}
+
+		f.scatter(ctx, regrouped, build, handleLocal, service, endpoint, format, opts)
+		scattered = append(scattered, regrouped...)
+	}
+
+	return scattered, nil
+}
+
+// scatter builds the requests of the responses and sends them in parallel,
+// setting the response or the error of every request on its response.
+func (f *Forwarder) scatter(ctx context.Context, responses []ScatterResponse, build RequestBuilder,
+	handleLocal LocalHandler, service, endpoint string, format tchannel.Format, opts *Options) {
+
+	var wg sync.WaitGroup
+	for i := range responses {
+		r := &responses[i]
+
+		r.Request, r.Err = build(r.Destination, r.Keys)
+		if r.Err != nil {
+			continue
+		}
+
+		if r.Local && handleLocal == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if r.Local {
+				r.Response, r.Err = handleLocal(ctx, r.Keys, r.Request)
+				return
+			}
+
+			r.Response, r.Err = f.ForwardRequestContext(ctx, r.Request, r.Destination, service,
+				endpoint, r.Keys, format, opts)
+		}()
+	}
+	wg.Wait()
+}
+
+// groupKeys looks up the owners of the keys and returns a response for every
+// owner with the keys it owns.
+func (f *Forwarder) groupKeys(keys []string, identity string) ([]ScatterResponse, error) {
+	var responses []ScatterResponse
+	index := make(map[string]int)
+
+	for _, key := range keys {
+		dest, err := f.sender.Lookup(key)
+		if err != nil {
+			return nil, err
+		}
+
+		i, ok := index[dest]
+		if !ok {
+			i = len(responses)
+			index[dest] = i
+			responses = append(responses, ScatterResponse{
+				Destination: dest,
+				Local:       dest == identity,
+			})
+		}
+		responses[i].Keys = append(responses[i].Keys, key)
+	}
+
+	return responses, nil
+}
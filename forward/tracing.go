@@ -0,0 +1,66 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package forward
+
+import (
+	"strings"
+
+	"github.com/uber/ringpop-go/tracing"
+)
+
+// Names of the spans created while forwarding a request.
+const (
+	spanForward = "ringpop.forward"
+	spanAttempt = "ringpop.forward.attempt"
+	spanRetry   = "ringpop.forward.retry"
+	spanReroute = "ringpop.forward.reroute"
+)
+
+// Tags that are set on the spans created while forwarding a request.
+const (
+	tagDestination = "ringpop.destination"
+	tagService     = "ringpop.service"
+	tagEndpoint    = "ringpop.endpoint"
+	tagKeys        = "ringpop.keys"
+	tagAttempt     = "ringpop.attempt"
+	tagError       = "error"
+)
+
+// startForwardSpan starts the span that covers all attempts of forwarding a
+// single request.
+func startForwardSpan(tracer tracing.Tracer, parent tracing.SpanContext, destination, service,
+	endpoint string, keys []string) tracing.Span {
+
+	span := tracer.StartSpan(spanForward, parent)
+	span.SetTag(tagDestination, destination)
+	span.SetTag(tagService, service)
+	span.SetTag(tagEndpoint, endpoint)
+	span.SetTag(tagKeys, strings.Join(keys, ","))
+	return span
+}
+
+// finishSpan marks the span as failed when err is not nil and finishes it.
+func finishSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.SetTag(tagError, true)
+	}
+	span.Finish()
+}
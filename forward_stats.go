@@ -0,0 +1,54 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ringpop
+
+import (
+	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/ringpop-go/util"
+)
+
+// destinationSummary summarizes the recent requests forwarded to a single
+// destination. Latencies are in milliseconds and include failed requests.
+type destinationSummary struct {
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"errorRate"`
+	LatencyP50 int64   `json:"latencyP50"`
+	LatencyP95 int64   `json:"latencyP95"`
+	LatencyP99 int64   `json:"latencyP99"`
+}
+
+// summarizeForwarding returns the summary of the stats of every destination
+// the forwarder recently sent requests to.
+func summarizeForwarding(stats map[string]forward.DestinationStats) map[string]destinationSummary {
+	summaries := make(map[string]destinationSummary, len(stats))
+	for destination, s := range stats {
+		summaries[destination] = destinationSummary{
+			Requests:   s.Requests,
+			Errors:     s.Errors,
+			ErrorRate:  float64(s.Errors) / float64(s.Requests),
+			LatencyP50: util.MS(s.LatencyP50),
+			LatencyP95: util.MS(s.LatencyP95),
+			LatencyP99: util.MS(s.LatencyP99),
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ringpop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/forward"
+)
+
+func TestSummarizeForwarding(t *testing.T) {
+	summary := summarizeForwarding(map[string]forward.DestinationStats{
+		"192.0.2.1:1": {
+			Requests:   10,
+			Errors:     2,
+			LatencyP50: 5 * time.Millisecond,
+			LatencyP95: 10 * time.Millisecond,
+			LatencyP99: 10 * time.Millisecond,
+		},
+		"192.0.2.2:1": {
+			Requests:   1,
+			Errors:     1,
+			LatencyP50: time.Second,
+			LatencyP95: time.Second,
+			LatencyP99: time.Second,
+		},
+	})
+
+	assert.Equal(t, map[string]destinationSummary{
+		"192.0.2.1:1": {
+			Requests:   10,
+			Errors:     2,
+			ErrorRate:  0.2,
+			LatencyP50: 5,
+			LatencyP95: 10,
+			LatencyP99: 10,
+		},
+		"192.0.2.2:1": {
+			Requests:   1,
+			Errors:     1,
+			ErrorRate:  1,
+			LatencyP50: 1000,
+			LatencyP95: 1000,
+			LatencyP99: 1000,
+		},
+	}, summary)
+}
@@ -32,9 +32,10 @@ type Arg struct{}
 
 func (rp *Ringpop) registerHandlers() error {
 	handlers := map[string]interface{}{
-		"/health":       rp.health,
-		"/admin/stats":  rp.adminStatsHandler,
-		"/admin/lookup": rp.adminLookupHandler,
+		"/health":           rp.health,
+		"/admin/stats":      rp.adminStatsHandler,
+		"/admin/lookup":     rp.adminLookupHandler,
+		"/admin/forwarding": rp.adminForwardingHandler,
 	}
 
 	return json.Register(rp.subChannel, handlers, func(ctx context.Context, err error) {
@@ -66,6 +67,12 @@ func (rp *Ringpop) adminLookupHandler(ctx json.Context, req *lookupRequest) (*lo
 	return &lookupResponse{Dest: dest}, nil
 }
 
+// adminForwardingHandler summarizes the latency and errors of the requests
+// recently forwarded to every destination.
+func (rp *Ringpop) adminForwardingHandler(ctx json.Context, req *Arg) (map[string]destinationSummary, error) {
+	return summarizeForwarding(rp.forwarder.Stats()), nil
+}
+
 func (rp *Ringpop) adminReloadHandler(ctx json.Context, req *Arg) (*Arg, error) {
 	return nil, nil
 }
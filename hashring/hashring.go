@@ -265,9 +265,100 @@ func (r *HashRing) Lookup(key string) (string, bool) {
 	return strs[0], true
 }
 
+// LookupChecksum is like Lookup but also returns the checksum of the HashRing
+// at the time of the lookup, so the owner and checksum are always consistent.
+func (r *HashRing) LookupChecksum(key string) (string, uint32, bool) {
+	r.RLock()
+	strs := r.lookupNNoLock(key, 1)
+	checksum := r.checksum
+	r.RUnlock()
+
+	if len(strs) == 0 {
+		return "", checksum, false
+	}
+	return strs[0], checksum, true
+}
+
+// A ReplicaRange is a range of hashes on the ring and the servers that
+// replicate the keys that hash into it. The range runs from Start, exclusive,
+// to End, inclusive, and wraps around the ring when Start is not smaller than
+// End. Replicas are sorted.
+type ReplicaRange struct {
+	Start    int
+	End      int
+	Replicas []string
+}
+
+// ReplicaRanges divides the ring into ranges of hashes that are replicated by
+// the same n servers, which are the servers LookupN returns for the keys in
+// the range. Adjacent ranges with the same replicas are merged. The ranges
+// are ordered by their end and cover the entire ring.
+func (r *HashRing) ReplicaRanges(n int) []ReplicaRange {
+	type token struct {
+		val    int
+		server string
+	}
+
+	r.RLock()
+	var tokens []token
+	r.tree.Walk(func(val int, server string) {
+		tokens = append(tokens, token{val, server})
+	})
+	if n > len(r.serverSet) {
+		n = len(r.serverSet)
+	}
+	r.RUnlock()
+
+	var ranges []ReplicaRange
+	for i, t := range tokens {
+		// the keys in the range ending at the token are replicated by the
+		// first n unique servers from the token onwards
+		unique := make(map[string]struct{}, n)
+		var replicas []string
+		for j := 0; len(replicas) < n; j++ {
+			server := tokens[(i+j)%len(tokens)].server
+			if _, ok := unique[server]; !ok {
+				unique[server] = struct{}{}
+				replicas = append(replicas, server)
+			}
+		}
+		sort.Strings(replicas)
+
+		if last := len(ranges) - 1; last >= 0 && equalStrings(ranges[last].Replicas, replicas) {
+			ranges[last].End = t.val
+			continue
+		}
+
+		ranges = append(ranges, ReplicaRange{
+			End:      t.val,
+			Replicas: replicas,
+		})
+	}
+
+	for i := range ranges {
+		ranges[(i+1)%len(ranges)].Start = ranges[i].End
+	}
+
+	return ranges
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // LookupN returns the N servers that own the given key. Duplicates in the form
 // of virtual nodes are skipped to maintain a list of unique servers. If there
-// are less servers than N, we simply return all existing servers.
+// are less servers than N, we simply return all existing servers. The servers
+// are returned in the order they are found walking the ring clockwise from the
+// key, so the first server is the owner of the key.
 func (r *HashRing) LookupN(key string, n int) []string {
 	r.RLock()
 	servers := r.lookupNNoLock(key, n)
@@ -277,25 +368,20 @@ func (r *HashRing) LookupN(key string, n int) []string {
 
 // This function isn't thread-safe, only call it when the HashRing is locked.
 func (r *HashRing) lookupNNoLock(key string, n int) []string {
-	if n >= len(r.serverSet) {
-		return r.copyServersNoLock()
+	if n > len(r.serverSet) {
+		n = len(r.serverSet)
 	}
 
 	hash := r.hashfunc(key)
-	unique := make(map[string]struct{})
+	unique := make(map[string]struct{}, n)
 
 	// lookup N unique servers from the red-black tree. If we have not
 	// collected all the servers we want, we have reached the
 	// end of the red-black tree and we need to loop around and inspect the
 	// tree starting at 0.
-	r.tree.LookupNUniqueAt(n, hash, unique)
-	if len(unique) < n {
-		r.tree.LookupNUniqueAt(n, 0, unique)
-	}
-
-	var servers []string
-	for server := range unique {
-		servers = append(servers, server)
+	servers := r.tree.LookupNUniqueAt(n, hash, unique, nil)
+	if len(servers) < n {
+		servers = r.tree.LookupNUniqueAt(n, 0, unique, servers)
 	}
 	return servers
 }
@@ -177,6 +177,27 @@ func TestLookup(t *testing.T) {
 	assert.False(t, ok, "expected Lookup to find no server for key to hash to")
 }
 
+func TestLookupChecksum(t *testing.T) {
+	ring := New(farm.Fingerprint32, 10)
+	ring.AddServer("server1")
+	ring.AddServer("server2")
+
+	server, checksum, ok := ring.LookupChecksum("key")
+	expected, _ := ring.Lookup("key")
+
+	assert.True(t, ok, "expected LookupChecksum to hash key to a server")
+	assert.Equal(t, expected, server, "expected LookupChecksum to find the same server as Lookup")
+	assert.Equal(t, ring.Checksum(), checksum, "expected the checksum of the ring")
+
+	ring.RemoveServer("server1")
+	ring.RemoveServer("server2")
+
+	_, checksum, ok = ring.LookupChecksum("key")
+
+	assert.False(t, ok, "expected LookupChecksum to find no server for key to hash to")
+	assert.Equal(t, ring.Checksum(), checksum, "expected the checksum of the empty ring")
+}
+
 func TestLookupDistribution(t *testing.T) {
 	ring := New(farm.Fingerprint32, 5)
 	addresses := genAddresses(1, 1, 1000)
@@ -268,13 +289,7 @@ func TestLookupNLoopAround(t *testing.T) {
 	addresses := genAddresses(1, 1, 10)
 	ring.AddRemoveServers(addresses, nil)
 
-	unique := make(map[string]struct{})
-	ring.tree.LookupNUniqueAt(1, 0, unique)
-	var firstInTree string
-	for server := range unique {
-		firstInTree = server
-		break
-	}
+	firstInTree := ring.tree.LookupNUniqueAt(1, 0, make(map[string]struct{}), nil)[0]
 
 	firstResult, ok := ring.Lookup("a random key")
 	assert.True(t, ok, "expected to obtain server that owns key")
@@ -321,6 +336,46 @@ func TestLookupN(t *testing.T) {
 	assert.Len(t, unique, 9, "expected to get nine unique servers")
 }
 
+// TestLookupNRingOrder tests that LookupN returns the servers in the order
+// they are found walking the ring clockwise from the key.
+func TestLookupNRingOrder(t *testing.T) {
+	ring := New(farm.Fingerprint32, 10)
+	ring.AddRemoveServers(genAddresses(1, 1, 10), nil)
+
+	var tokens []int
+	var owners []string
+	ring.tree.Walk(func(val int, server string) {
+		tokens = append(tokens, val)
+		owners = append(owners, server)
+	})
+
+	for _, key := range []string{"key", "another key", "yet another key", "a random key"} {
+		hash := ring.hashfunc(key)
+		start := sort.SearchInts(tokens, hash)
+
+		var expected []string
+		seen := make(map[string]bool)
+		for i := 0; len(expected) < 10; i++ {
+			server := owners[(start+i)%len(owners)]
+			if !seen[server] {
+				seen[server] = true
+				expected = append(expected, server)
+			}
+		}
+
+		for _, n := range []int{1, 3, 10, 20} {
+			want := expected
+			if n < len(want) {
+				want = want[:n]
+			}
+			assert.Equal(t, want, ring.LookupN(key, n), "expected servers in ring order for %q with n=%d", key, n)
+		}
+
+		owner, _ := ring.Lookup(key)
+		assert.Equal(t, expected[0], owner, "expected the first server to be the owner")
+	}
+}
+
 func genAddresses(host, fromPort, toPort int) []string {
 	var addresses []string
 	for i := fromPort; i <= toPort; i++ {
@@ -352,3 +407,48 @@ func BenchmarkHashRingLookupN(b *testing.B) {
 		}
 	}
 }
+
+// TestReplicaRanges tests that every key is replicated by the servers of the
+// range its hash falls into.
+func TestReplicaRanges(t *testing.T) {
+	ring := New(farm.Fingerprint32, 10)
+	ring.AddRemoveServers(genAddresses(1, 1, 5), nil)
+
+	ranges := ring.ReplicaRanges(3)
+	assert.NotEmpty(t, ranges)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		hash := ring.hashfunc(key)
+
+		// the first range that ends at or after the hash, or the range that
+		// wraps around the ring
+		found := ranges[0]
+		for _, r := range ranges {
+			if hash <= r.End {
+				found = r
+				break
+			}
+		}
+
+		expected := ring.LookupN(key, 3)
+		sort.Strings(expected)
+		assert.Equal(t, expected, found.Replicas, "expected key %s to be replicated by its range", key)
+	}
+
+	for i, r := range ranges {
+		assert.Equal(t, ranges[(i+len(ranges)-1)%len(ranges)].End, r.Start, "expected ranges to be adjacent")
+	}
+}
+
+func TestReplicaRangesSingleServer(t *testing.T) {
+	ring := New(farm.Fingerprint32, 10)
+	ring.AddServer("server1")
+
+	ranges := ring.ReplicaRanges(3)
+	assert.Len(t, ranges, 1, "expected a single range covering the ring")
+	assert.Equal(t, []string{"server1"}, ranges[0].Replicas)
+	assert.Equal(t, ranges[0].Start, ranges[0].End)
+
+	assert.Empty(t, New(farm.Fingerprint32, 10).ReplicaRanges(3))
+}
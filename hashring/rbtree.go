@@ -256,33 +256,53 @@ func (t *redBlackTree) Search(val int) (string, bool) {
 	return t.root.search(val)
 }
 
-// LookupNAt iterates through the tree from the node with value val, and
-// returns the next n unique strings. This function is not guaranteed to
-// return n strings.
-func (t *redBlackTree) LookupNUniqueAt(n int, val int, result map[string]struct{}) {
-	findNUniqueAbove(t.root, n, val, result)
+// LookupNUniqueAt iterates through the tree from the node with value val, and
+// appends the next unique strings to result, in ascending order of value,
+// until it holds n strings. Strings already in unique are skipped. This
+// function is not guaranteed to return n strings.
+func (t *redBlackTree) LookupNUniqueAt(n int, val int, unique map[string]struct{}, result []string) []string {
+	return findNUniqueAbove(t.root, n, val, unique, result)
 }
 
-// findNUniqueAbove is a recursive search that finds n unique strings
+// findNUniqueAbove is a recursive in-order search that finds n unique strings
 // with a value bigger or equal than val
-func findNUniqueAbove(node *redBlackNode, n int, val int, result map[string]struct{}) {
+func findNUniqueAbove(node *redBlackNode, n int, val int, unique map[string]struct{}, result []string) []string {
 	if len(result) >= n || node == nil {
-		return
+		return result
 	}
 
 	// skip left branch when all its values are smaller than val
 	if node.val >= val {
-		findNUniqueAbove(node.left, n, val, result)
+		result = findNUniqueAbove(node.left, n, val, unique, result)
 	}
 
 	// Make sure to stop when we have n unique strings
 	if len(result) >= n {
-		return
+		return result
 	}
 
 	if node.val >= val {
-		result[node.str] = struct{}{}
+		if _, ok := unique[node.str]; !ok {
+			unique[node.str] = struct{}{}
+			result = append(result, node.str)
+		}
 	}
 
-	findNUniqueAbove(node.right, n, val, result)
+	return findNUniqueAbove(node.right, n, val, unique, result)
+}
+
+// walk calls fn for every node of the tree in ascending order of value.
+func (n *redBlackNode) walk(fn func(val int, str string)) {
+	if n == nil {
+		return
+	}
+	n.left.walk(fn)
+	fn(n.val, n.str)
+	n.right.walk(fn)
+}
+
+// Walk calls fn for the value and string of every node in the redBlackTree in
+// ascending order of value.
+func (t *redBlackTree) Walk(fn func(val int, str string)) {
+	t.root.walk(fn)
 }
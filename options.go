@@ -26,10 +26,12 @@ import (
 
 	"github.com/benbjohnson/clock"
 	log "github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/forward"
 	"github.com/uber/ringpop-go/hashring"
 	"github.com/uber/ringpop-go/logging"
 	"github.com/uber/ringpop-go/shared"
 	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/tracing"
 )
 
 type configuration struct {
@@ -47,8 +49,25 @@ type configuration struct {
 
 	// StateTimeouts keeps the state transition timeouts for swim to use
 	StateTimeouts swim.StateTimeouts
+
+	// ForwardLoopPolicy determines what happens to requests that were already
+	// forwarded but are not owned by this node either.
+	ForwardLoopPolicy LoopPolicy
 }
 
+// LoopPolicy determines how HandleOrForwardContext treats a request that was
+// already forwarded by another node but is not owned by this node either.
+type LoopPolicy int
+
+const (
+	// HandleLoopsLocally handles the request locally instead of forwarding
+	// it again. This is the default.
+	HandleLoopsLocally LoopPolicy = iota
+
+	// FailLoops fails the request with a *ForwardLoopError.
+	FailLoops
+)
+
 // An Option is a modifier functions that configure/modify a real Ringpop
 // object.
 //
@@ -166,6 +185,62 @@ func Statter(s log.StatsReporter) Option {
 	}
 }
 
+// Tracer is used to specify the tracer that creates spans around forwarded
+// requests and propagates them to the destination in the request headers. If
+// a tracer is not provided, a no-op tracer is used.
+func Tracer(t tracing.Tracer) Option {
+	return func(r *Ringpop) error {
+		if t == nil {
+			return errors.New("tracer is required")
+		}
+		r.tracer = t
+		return nil
+	}
+}
+
+// ForwardCircuitBreaker enables a circuit breaker per destination for
+// forwarded requests. Once the circuit of a destination opens, requests to it
+// fail fast or, when enabled in the options, are rerouted to the next owner of
+// their keys. By default forwarded requests are not circuit broken.
+func ForwardCircuitBreaker(opts forward.BreakerOptions) Option {
+	return func(r *Ringpop) error {
+		r.forwarderOptions = append(r.forwarderOptions, forward.CircuitBreaker(opts))
+		return nil
+	}
+}
+
+// ForwardInflightLimit limits the number of requests that are forwarded at the
+// same time, in total and per destination, so that a slow destination cannot
+// exhaust the resources of the nodes forwarding to it. Requests over a limit
+// are queued or rejected with a *forward.InflightLimitError. By default
+// forwarded requests are not limited.
+func ForwardInflightLimit(opts forward.LimitOptions) Option {
+	return func(r *Ringpop) error {
+		r.forwarderOptions = append(r.forwarderOptions, forward.InflightLimit(opts))
+		return nil
+	}
+}
+
+// ForwardRetryBudget limits the retries of forwarded requests to a ratio of
+// the number of forwarded requests, so that retries cannot multiply the load
+// on a ring that is already in trouble. By default retries are not limited.
+func ForwardRetryBudget(opts forward.RetryBudgetOptions) Option {
+	return func(r *Ringpop) error {
+		r.forwarderOptions = append(r.forwarderOptions, forward.RetryBudget(opts))
+		return nil
+	}
+}
+
+// ForwardLoopPolicy configures how requests are treated that were already
+// forwarded by another node but are not owned by this node either. They are
+// never forwarded again; by default they are handled locally.
+func ForwardLoopPolicy(policy LoopPolicy) Option {
+	return func(r *Ringpop) error {
+		r.config.ForwardLoopPolicy = policy
+		return nil
+	}
+}
+
 // Identity is used to specify a static hostport string as this Ringpop
 // instance's identity.
 //
@@ -310,6 +385,10 @@ func defaultStatter(r *Ringpop) error {
 	return Statter(noopStatsReporter{})(r)
 }
 
+func defaultTracer(r *Ringpop) error {
+	return Tracer(tracing.NoopTracer{})(r)
+}
+
 func defaultHashRingOptions(r *Ringpop) error {
 	return HashRingConfig(defaultHashRingConfiguration)(r)
 }
@@ -329,6 +408,7 @@ var defaultOptions = []Option{
 	defaultIdentityResolver,
 	defaultLogLevels,
 	defaultStatter,
+	defaultTracer,
 	defaultMembershipChecksumStatPeriod,
 	defaultRingChecksumStatPeriod,
 	defaultHashRingOptions,
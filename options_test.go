@@ -26,9 +26,11 @@ import (
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"github.com/uber/ringpop-go/forward"
 	"github.com/uber/ringpop-go/hashring"
 	"github.com/uber/ringpop-go/logging"
 	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/ringpop-go/tracing"
 	"github.com/uber/tchannel-go"
 )
 
@@ -187,6 +189,44 @@ func (s *RingpopOptionsTestSuite) TestClockNil() {
 	s.Error(err)
 }
 
+// TestDefaultTracer confirms that tracing is disabled by default.
+func (s *RingpopOptionsTestSuite) TestDefaultTracer() {
+	rp, err := New("test", Channel(s.channel))
+	s.NoError(err)
+	s.Equal(tracing.NoopTracer{}, rp.tracer)
+}
+
+// TestForwardCircuitBreaker confirms that the circuit breaker option is
+// passed on to the forwarder.
+func (s *RingpopOptionsTestSuite) TestForwardCircuitBreaker() {
+	rp, err := New("test", Channel(s.channel), ForwardCircuitBreaker(forward.BreakerOptions{}))
+	s.NoError(err)
+	s.Len(rp.forwarderOptions, 1)
+}
+
+// TestForwardInflightLimit confirms that the inflight limit option is passed
+// on to the forwarder.
+func (s *RingpopOptionsTestSuite) TestForwardInflightLimit() {
+	rp, err := New("test", Channel(s.channel), ForwardInflightLimit(forward.LimitOptions{MaxInflight: 10}))
+	s.NoError(err)
+	s.Len(rp.forwarderOptions, 1)
+}
+
+// TestForwardRetryBudget confirms that the retry budget option is passed on
+// to the forwarder.
+func (s *RingpopOptionsTestSuite) TestForwardRetryBudget() {
+	rp, err := New("test", Channel(s.channel), ForwardRetryBudget(forward.RetryBudgetOptions{Ratio: 0.1}))
+	s.NoError(err)
+	s.Len(rp.forwarderOptions, 1)
+}
+
+// TestTracerNil confirms that nil tracer option returns an error.
+func (s *RingpopOptionsTestSuite) TestTracerNil() {
+	rp, err := New("test", Channel(s.channel), Tracer(nil))
+	s.Nil(rp)
+	s.Error(err)
+}
+
 // TestDefaultRingChecksumStatPeriod confirms that default gets installed.
 func (s *RingpopOptionsTestSuite) TestDefaultRingChecksumStatPeriod() {
 	rp, err := New("test", Channel(s.channel))
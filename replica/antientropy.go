@@ -0,0 +1,343 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	log "github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/logging"
+	"github.com/uber/ringpop-go/shared"
+	"github.com/uber/ringpop-go/util"
+	"github.com/uber/tchannel-go/json"
+	"golang.org/x/net/context"
+)
+
+// digestEndpoint is the endpoint that returns the digests of ranges to the
+// other replicas of the ranges.
+const digestEndpoint = "/replica/digest"
+
+// A DigestFunc returns the digest of the data the local node stores for the
+// range of hashes from start, exclusive, to end, inclusive, such as the root
+// of a Merkle tree of the range. The range wraps around the ring when start
+// is not smaller than end.
+type DigestFunc func(start, end int) ([]byte, error)
+
+// A DivergedRange is a range of hashes whose digest on one of its replicas
+// differs from the digest of the local node.
+type DivergedRange struct {
+	Start         int
+	End           int
+	Replica       string
+	LocalDigest   []byte
+	ReplicaDigest []byte
+}
+
+// A DivergedFunc is called with the ranges that differ from their replicas
+// after every comparison that found differences, so the application can
+// repair them.
+type DivergedFunc func(ranges []DivergedRange)
+
+// AntiEntropyOptions configure the comparisons of an AntiEntropy.
+type AntiEntropyOptions struct {
+	// NValue is the number of replicas of every range.
+	NValue int
+
+	// Interval is the time between two comparisons.
+	Interval time.Duration
+
+	// Timeout limits every request for the digest of a replica.
+	Timeout time.Duration
+
+	Clock clock.Clock
+}
+
+func defaultAntiEntropyOptions() *AntiEntropyOptions {
+	return &AntiEntropyOptions{
+		NValue:   3,
+		Interval: time.Minute,
+		Timeout:  time.Second,
+		Clock:    clock.New(),
+	}
+}
+
+func mergeAntiEntropyOptions(opts *AntiEntropyOptions) *AntiEntropyOptions {
+	def := defaultAntiEntropyOptions()
+	if opts == nil {
+		return def
+	}
+
+	merged := *opts
+	merged.NValue = util.SelectInt(opts.NValue, def.NValue)
+	merged.Interval = util.SelectDuration(opts.Interval, def.Interval)
+	merged.Timeout = util.SelectDuration(opts.Timeout, def.Timeout)
+	if merged.Clock == nil {
+		merged.Clock = def.Clock
+	}
+	return &merged
+}
+
+// An AntiEntropy periodically compares the digests of the ranges the local
+// node replicates with the digests of the other replicas of the ranges, the
+// servers LookupN returns for the keys in the range, and reports the ranges
+// that differ. Every node of the ring needs an AntiEntropy on the same
+// SubChannel to serve the digests of its ranges.
+type AntiEntropy struct {
+	source   RangeSource
+	channel  shared.SubChannel
+	digest   DigestFunc
+	diverged DivergedFunc
+	opts     *AntiEntropyOptions
+	logger   log.Logger
+
+	sync.Mutex
+	stop chan struct{}
+}
+
+type digestRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type digestRequest struct {
+	Ranges []digestRange `json:"ranges"`
+}
+
+// A rangeDigest is the digest of a single range, or the error that occurred
+// while digesting it.
+type rangeDigest struct {
+	Digest []byte `json:"digest,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type digestResponse struct {
+	Digests []rangeDigest `json:"digests"`
+}
+
+// NewAntiEntropy returns an AntiEntropy that compares the ranges of the
+// source with the digest function, and serves the digests of the local ranges
+// on the SubChannel. The ranges that differ are passed to diverged.
+func NewAntiEntropy(source RangeSource, channel shared.SubChannel, digest DigestFunc,
+	diverged DivergedFunc, opts *AntiEntropyOptions) (*AntiEntropy, error) {
+
+	logger := logging.Logger("antientropy")
+	if identity, err := source.WhoAmI(); err == nil {
+		logger = logger.WithField("local", identity)
+	}
+
+	a := &AntiEntropy{
+		source:   source,
+		channel:  channel,
+		digest:   digest,
+		diverged: diverged,
+		opts:     mergeAntiEntropyOptions(opts),
+		logger:   logger,
+	}
+
+	handlers := map[string]interface{}{
+		digestEndpoint: a.digestHandler,
+	}
+	err := json.Register(channel, handlers, func(ctx context.Context, err error) {
+		a.logger.WithField("error", err).Info("error occured")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *AntiEntropy) digestHandler(ctx json.Context, req *digestRequest) (*digestResponse, error) {
+	res := &digestResponse{Digests: make([]rangeDigest, len(req.Ranges))}
+	for i, r := range req.Ranges {
+		digest, err := a.digest(r.Start, r.End)
+		if err != nil {
+			res.Digests[i].Error = err.Error()
+			continue
+		}
+		res.Digests[i].Digest = digest
+	}
+	return res, nil
+}
+
+// Start compares the ranges periodically until Stop is called.
+func (a *AntiEntropy) Start() {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.stop != nil {
+		return
+	}
+	a.stop = make(chan struct{})
+	go a.run(a.stop)
+}
+
+// Stop stops the periodic comparisons. A comparison that is in progress runs
+// to completion.
+func (a *AntiEntropy) Stop() {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	a.stop = nil
+}
+
+func (a *AntiEntropy) run(stop <-chan struct{}) {
+	ticker := a.opts.Clock.Ticker(a.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := a.Compare(); err != nil {
+				a.logger.WithField("error", err).Warn("anti-entropy unable to compare ranges")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Compare compares the digest of every range the local node replicates with
+// the digests of the other replicas of the range, and passes the ranges that
+// differ to the diverged function. Every replica is asked for the digests of
+// all ranges it shares with the local node in a single request, and the
+// ranges that differ are grouped by replica. Replicas that fail to return
+// their digests are skipped until the next comparison.
+func (a *AntiEntropy) Compare() ([]DivergedRange, error) {
+	local, err := a.source.WhoAmI()
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := a.source.ReplicaRanges(a.opts.NValue)
+	if err != nil {
+		return nil, err
+	}
+
+	// the digested local ranges, and the indexes of the ranges every other
+	// replica shares with the local node
+	var digested []DivergedRange
+	var replicas []string
+	byReplica := make(map[string][]int)
+
+	for _, r := range ranges {
+		if !containsString(r.Replicas, local) {
+			continue
+		}
+
+		localDigest, err := a.digest(r.Start, r.End)
+		if err != nil {
+			a.logger.WithFields(log.Fields{
+				"start": r.Start,
+				"end":   r.End,
+				"error": err,
+			}).Warn("anti-entropy unable to digest range")
+			continue
+		}
+
+		i := len(digested)
+		digested = append(digested, DivergedRange{
+			Start:       r.Start,
+			End:         r.End,
+			LocalDigest: localDigest,
+		})
+
+		for _, replica := range r.Replicas {
+			if replica == local {
+				continue
+			}
+			if _, ok := byReplica[replica]; !ok {
+				replicas = append(replicas, replica)
+			}
+			byReplica[replica] = append(byReplica[replica], i)
+		}
+	}
+
+	var diverged []DivergedRange
+	for _, replica := range replicas {
+		indexes := byReplica[replica]
+
+		req := &digestRequest{Ranges: make([]digestRange, len(indexes))}
+		for j, i := range indexes {
+			req.Ranges[j] = digestRange{Start: digested[i].Start, End: digested[i].End}
+		}
+
+		digests, err := a.replicaDigests(replica, req)
+		if err != nil {
+			a.logger.WithFields(log.Fields{
+				"replica": replica,
+				"ranges":  len(indexes),
+				"error":   err,
+			}).Debug("anti-entropy unable to get digests of replica")
+			continue
+		}
+
+		for j, i := range indexes {
+			r := digested[i]
+			if digests[j].Error != "" {
+				a.logger.WithFields(log.Fields{
+					"replica": replica,
+					"start":   r.Start,
+					"end":     r.End,
+					"error":   digests[j].Error,
+				}).Debug("anti-entropy replica unable to digest range")
+				continue
+			}
+
+			if !bytes.Equal(r.LocalDigest, digests[j].Digest) {
+				r.Replica = replica
+				r.ReplicaDigest = digests[j].Digest
+				diverged = append(diverged, r)
+			}
+		}
+	}
+
+	if len(diverged) > 0 && a.diverged != nil {
+		a.diverged(diverged)
+	}
+
+	return diverged, nil
+}
+
+// replicaDigests requests the digests of the ranges from the replica.
+func (a *AntiEntropy) replicaDigests(replica string, req *digestRequest) ([]rangeDigest, error) {
+	ctx, cancel := shared.NewTChannelContext(a.opts.Timeout)
+	defer cancel()
+
+	peer := a.channel.Peers().GetOrAdd(replica)
+	res := &digestResponse{}
+	if err := json.CallPeer(ctx, peer, a.channel.ServiceName(), digestEndpoint, req, res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Digests) != len(req.Ranges) {
+		return nil, fmt.Errorf("replica returned %d digests for %d ranges", len(res.Digests), len(req.Ranges))
+	}
+	return res.Digests, nil
+}
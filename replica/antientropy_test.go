@@ -0,0 +1,212 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/ringpop-go/hashring"
+	"github.com/uber/tchannel-go"
+)
+
+// rangeSource is a RangeSource with fixed ranges.
+type rangeSource struct {
+	local  string
+	ranges []hashring.ReplicaRange
+}
+
+func (s rangeSource) WhoAmI() (string, error) {
+	return s.local, nil
+}
+
+func (s rangeSource) ReplicaRanges(n int) ([]hashring.ReplicaRange, error) {
+	return s.ranges, nil
+}
+
+// newAntiEntropyNode starts a node that serves the digests of the function.
+func newAntiEntropyNode(t *testing.T, digest DigestFunc) (*tchannel.Channel, *AntiEntropy, *rangeSource) {
+	ch, err := tchannel.NewChannel("antientropy", nil)
+	require.NoError(t, err)
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"))
+
+	source := &rangeSource{local: ch.PeerInfo().HostPort}
+	a, err := NewAntiEntropy(source, ch.GetSubChannel("kv"), digest, nil, &AntiEntropyOptions{
+		Timeout: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	return ch, a, source
+}
+
+func TestAntiEntropyCompare(t *testing.T) {
+	digests := map[int][]byte{100: []byte("a"), 200: []byte("b"), 300: []byte("c")}
+	digest := func(start, end int) ([]byte, error) {
+		return digests[end], nil
+	}
+	staleDigest := func(start, end int) ([]byte, error) {
+		if end == 200 {
+			return []byte("stale"), nil
+		}
+		return digests[end], nil
+	}
+
+	ch1, a, source := newAntiEntropyNode(t, digest)
+	defer ch1.Close()
+	ch2, _, _ := newAntiEntropyNode(t, digest)
+	defer ch2.Close()
+	ch3, _, _ := newAntiEntropyNode(t, staleDigest)
+	defer ch3.Close()
+
+	local := ch1.PeerInfo().HostPort
+	replica2 := ch2.PeerInfo().HostPort
+	replica3 := ch3.PeerInfo().HostPort
+	source.ranges = []hashring.ReplicaRange{
+		{Start: 300, End: 100, Replicas: []string{local, replica2, replica3}},
+		{Start: 100, End: 200, Replicas: []string{local, replica2, replica3}},
+		{Start: 200, End: 300, Replicas: []string{replica2, replica3}},
+	}
+
+	var reported []DivergedRange
+	a.diverged = func(ranges []DivergedRange) {
+		reported = ranges
+	}
+
+	diverged, err := a.Compare()
+	require.NoError(t, err)
+	assert.Equal(t, []DivergedRange{{
+		Start:         100,
+		End:           200,
+		Replica:       replica3,
+		LocalDigest:   []byte("b"),
+		ReplicaDigest: []byte("stale"),
+	}}, diverged)
+	assert.Equal(t, diverged, reported, "expected the diverged ranges to be reported")
+}
+
+func TestAntiEntropyCompareBatch(t *testing.T) {
+	digest := func(start, end int) ([]byte, error) {
+		return []byte("a"), nil
+	}
+	replicaDigest := func(start, end int) ([]byte, error) {
+		if end == 100 {
+			return nil, errors.New("digest failed")
+		}
+		return []byte("stale"), nil
+	}
+
+	ch1, a, source := newAntiEntropyNode(t, digest)
+	defer ch1.Close()
+	ch2, _, _ := newAntiEntropyNode(t, replicaDigest)
+	defer ch2.Close()
+
+	local := ch1.PeerInfo().HostPort
+	replica := ch2.PeerInfo().HostPort
+	source.ranges = []hashring.ReplicaRange{
+		{Start: 300, End: 100, Replicas: []string{local, replica}},
+		{Start: 100, End: 200, Replicas: []string{local, replica}},
+		{Start: 200, End: 300, Replicas: []string{replica, local}},
+	}
+
+	diverged, err := a.Compare()
+	require.NoError(t, err)
+	assert.Equal(t, []DivergedRange{{
+		Start:         100,
+		End:           200,
+		Replica:       replica,
+		LocalDigest:   []byte("a"),
+		ReplicaDigest: []byte("stale"),
+	}, {
+		Start:         200,
+		End:           300,
+		Replica:       replica,
+		LocalDigest:   []byte("a"),
+		ReplicaDigest: []byte("stale"),
+	}}, diverged, "expected ranges the replica fails to digest to be skipped")
+}
+
+func TestAntiEntropyCompareUnreachable(t *testing.T) {
+	ch, a, source := newAntiEntropyNode(t, func(start, end int) ([]byte, error) {
+		return []byte("a"), nil
+	})
+	defer ch.Close()
+
+	source.ranges = []hashring.ReplicaRange{
+		{Start: 300, End: 100, Replicas: []string{ch.PeerInfo().HostPort, "127.0.0.1:3012"}},
+	}
+	a.diverged = func(ranges []DivergedRange) {
+		t.Error("expected no diverged ranges")
+	}
+
+	diverged, err := a.Compare()
+	assert.NoError(t, err)
+	assert.Empty(t, diverged, "expected unreachable replicas to be skipped")
+
+	// ranges that fail to digest are skipped
+	a.digest = func(start, end int) ([]byte, error) {
+		return nil, errors.New("digest failed")
+	}
+	diverged, err = a.Compare()
+	assert.NoError(t, err)
+	assert.Empty(t, diverged)
+}
+
+func TestAntiEntropyStartStop(t *testing.T) {
+	ch, a, source := newAntiEntropyNode(t, func(start, end int) ([]byte, error) {
+		return []byte("a"), nil
+	})
+	defer ch.Close()
+
+	source.ranges = []hashring.ReplicaRange{
+		{Start: 300, End: 100, Replicas: []string{ch.PeerInfo().HostPort, "127.0.0.1:3012"}},
+	}
+
+	compared := make(chan struct{}, 1)
+	a.digest = func(start, end int) ([]byte, error) {
+		select {
+		case compared <- struct{}{}:
+		default:
+		}
+		return []byte("a"), nil
+	}
+
+	c := clock.NewMock()
+	a.opts.Clock = c
+	a.Start()
+	a.Start()
+	defer a.Stop()
+
+	// wait for the ticker of the mock clock to be set up
+	time.Sleep(10 * time.Millisecond)
+	c.Add(a.opts.Interval)
+
+	select {
+	case <-compared:
+	case <-time.After(time.Second):
+		t.Fatal("expected the ranges to be compared after the interval")
+	}
+
+	a.Stop()
+	a.Stop()
+}
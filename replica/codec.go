@@ -0,0 +1,123 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"bytes"
+	"encoding/json"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// EncodeJSON returns the JSON encoding of v as the body of a request.
+func EncodeJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// EncodeThrift returns the thrift binary encoding of s as the body of a
+// request.
+func EncodeThrift(s athrift.TStruct) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	transport := athrift.NewStreamTransportW(&buffer)
+	if err := s.Write(athrift.NewTBinaryProtocolTransport(transport)); err != nil {
+		return nil, err
+	}
+
+	if err := transport.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecodeJSON decodes the JSON body of the response into v.
+func (r Response) DecodeJSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// DecodeThrift decodes the thrift binary body of the response into s.
+func (r Response) DecodeThrift(s athrift.TStruct) error {
+	transport := athrift.NewStreamTransportR(bytes.NewReader(r.Body))
+	return s.Read(athrift.NewTBinaryProtocolTransport(transport))
+}
+
+// ReadJSON is like ReadContext but encodes the request as JSON and sends it
+// in the JSON format. Use DecodeJSON to decode the responses.
+func (r *Replicator) ReadJSON(ctx context.Context, keys []string, request interface{}, operation string,
+	fopts *forward.Options, opts *Options) ([]Response, error) {
+
+	body, err := EncodeJSON(request)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadContext(ctx, keys, body, operation, fopts, withFormat(opts, tchannel.JSON))
+}
+
+// WriteJSON is like WriteContext but encodes the request as JSON and sends it
+// in the JSON format. Use DecodeJSON to decode the responses.
+func (r *Replicator) WriteJSON(ctx context.Context, keys []string, request interface{}, operation string,
+	fopts *forward.Options, opts *Options) ([]Response, error) {
+
+	body, err := EncodeJSON(request)
+	if err != nil {
+		return nil, err
+	}
+	return r.WriteContext(ctx, keys, body, operation, fopts, withFormat(opts, tchannel.JSON))
+}
+
+// ReadThrift is like ReadContext but encodes the request as thrift and sends
+// it in the Thrift format. The operation is the thrift method, such as
+// "Service::method". Use DecodeThrift to decode the responses.
+func (r *Replicator) ReadThrift(ctx context.Context, keys []string, request athrift.TStruct, operation string,
+	fopts *forward.Options, opts *Options) ([]Response, error) {
+
+	body, err := EncodeThrift(request)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadContext(ctx, keys, body, operation, fopts, withFormat(opts, tchannel.Thrift))
+}
+
+// WriteThrift is like WriteContext but encodes the request as thrift and
+// sends it in the Thrift format. The operation is the thrift method, such as
+// "Service::method". Use DecodeThrift to decode the responses.
+func (r *Replicator) WriteThrift(ctx context.Context, keys []string, request athrift.TStruct, operation string,
+	fopts *forward.Options, opts *Options) ([]Response, error) {
+
+	body, err := EncodeThrift(request)
+	if err != nil {
+		return nil, err
+	}
+	return r.WriteContext(ctx, keys, body, operation, fopts, withFormat(opts, tchannel.Thrift))
+}
+
+// withFormat returns a copy of the options with the format set.
+func withFormat(opts *Options, format tchannel.Format) *Options {
+	var copied Options
+	if opts != nil {
+		copied = *opts
+	}
+	copied.Format = format
+	return &copied
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/thrift/pingpong"
+	"github.com/uber/tchannel-go"
+)
+
+func TestThriftRoundTrip(t *testing.T) {
+	body, err := EncodeThrift(&pingpong.Ping{Key: "key"})
+	assert.NoError(t, err)
+
+	var ping pingpong.Ping
+	assert.NoError(t, Response{Body: body}.DecodeThrift(&ping))
+	assert.Equal(t, "key", ping.Key)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	body, err := EncodeJSON(Ping{From: "127.0.0.1:3001"})
+	assert.NoError(t, err)
+
+	var ping Ping
+	assert.NoError(t, Response{Body: body}.DecodeJSON(&ping))
+	assert.Equal(t, "127.0.0.1:3001", ping.From)
+}
+
+func TestWithFormat(t *testing.T) {
+	opts := &Options{NValue: 2}
+	assert.Equal(t, &Options{NValue: 2, Format: tchannel.Thrift}, withFormat(opts, tchannel.Thrift))
+	assert.Equal(t, tchannel.Format(""), opts.Format, "expected the options not to be modified")
+	assert.Equal(t, &Options{Format: tchannel.JSON}, withFormat(nil, tchannel.JSON))
+}
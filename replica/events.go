@@ -0,0 +1,115 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import "time"
+
+// A StragglerCompletedEvent is emitted when a replicated call that was
+// detached from its request completes. Err is nil when the call succeeded.
+type StragglerCompletedEvent struct {
+	Destination string
+	Keys        []string
+	Operation   string
+	Err         error
+}
+
+// A ReadRepairEvent is emitted when the resolved value of a read was written
+// back to a stale replica. Err is nil when the repair succeeded.
+type ReadRepairEvent struct {
+	Destination string
+	Keys        []string
+	Err         error
+}
+
+// A HintStoredEvent is emitted when a write that failed to reach its
+// destination was handed off to a substitute and the substitute stored a hint
+// for it
+type HintStoredEvent struct {
+	Destination string
+	Substitute  string
+	Keys        []string
+}
+
+// A HintReplayedEvent is emitted by the substitute when a hinted write was
+// replayed to its destination. Err is nil when the replay succeeded, otherwise the hint is
+// stored again.
+type HintReplayedEvent struct {
+	Destination string
+	Keys        []string
+	Err         error
+}
+
+// A BackupCompletedEvent is emitted when a write in PrimaryBackup mode was
+// propagated to a backup asynchronously. Err is nil when the write succeeded.
+type BackupCompletedEvent struct {
+	Destination string
+	Keys        []string
+	Operation   string
+	Err         error
+}
+
+// A RequestStartedEvent is emitted when a replicated request starts. Method is
+// either "read" or "write", and Operation is the endpoint of the request.
+type RequestStartedEvent struct {
+	Method    string
+	Operation string
+	Keys      []string
+}
+
+// A QuorumMetEvent is emitted when every key of a replicated request met its
+// R or W value.
+type QuorumMetEvent struct {
+	Method    string
+	Operation string
+	Keys      []string
+	RWValue   int
+}
+
+// A QuorumFailedEvent is emitted when a replicated request did not satisfy
+// its R or W value. KeysMissed are the keys that did not meet it.
+type QuorumFailedEvent struct {
+	Method     string
+	Operation  string
+	Keys       []string
+	KeysMissed []string
+	RWValue    int
+}
+
+// A DestinationErrorEvent is emitted for every destination of a replicated
+// request that failed or timed out.
+type DestinationErrorEvent struct {
+	Method      string
+	Operation   string
+	Destination string
+	Keys        []string
+	Outcome     Outcome
+	Err         error
+}
+
+// A FanoutLatencyEvent is emitted when the fanout of a replicated request
+// completes, with the time it took to collect the outcome of its
+// destinations.
+type FanoutLatencyEvent struct {
+	Method       string
+	Operation    string
+	Destinations int
+	Duration     time.Duration
+}
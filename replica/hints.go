@@ -0,0 +1,137 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel-go"
+)
+
+// A Hint is a write that could not be delivered to the replica that owns its
+// keys. The write was handed off to another node instead, the substitute,
+// which keeps the hint and replays the write to the owner once it is
+// reachable again.
+type Hint struct {
+	Destination string
+	Substitute  string
+	Keys        []string
+	Request     []byte
+	Operation   string
+	Format      tchannel.Format
+	Service     string
+	NValue      int
+	Created     time.Time
+}
+
+// A HintStore stores the hints of the writes that were handed off, until they
+// are replayed to their destination. Implementations must be thread safe.
+type HintStore interface {
+	// Store adds a hint for its destination.
+	Store(hint Hint) error
+
+	// Take removes and returns all hints for the destination.
+	Take(destination string) ([]Hint, error)
+
+	// Destinations returns the destinations that have hints.
+	Destinations() ([]string, error)
+}
+
+// A MemoryHintStore is a HintStore that keeps hints in memory. Hints are lost
+// when the process exits.
+type MemoryHintStore struct {
+	sync.Mutex
+	hints map[string][]Hint
+	max   int
+}
+
+// NewMemoryHintStore returns a MemoryHintStore that keeps at most max hints
+// per destination, dropping the oldest hints first. A max of zero or less
+// keeps an unlimited number of hints.
+func NewMemoryHintStore(max int) *MemoryHintStore {
+	return &MemoryHintStore{
+		hints: make(map[string][]Hint),
+		max:   max,
+	}
+}
+
+// Store adds a hint for its destination.
+func (s *MemoryHintStore) Store(hint Hint) error {
+	s.Lock()
+	defer s.Unlock()
+
+	hints := append(s.hints[hint.Destination], hint)
+	if s.max > 0 && len(hints) > s.max {
+		hints = hints[len(hints)-s.max:]
+	}
+	s.hints[hint.Destination] = hints
+	return nil
+}
+
+// Take removes and returns all hints for the destination.
+func (s *MemoryHintStore) Take(destination string) ([]Hint, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	hints := s.hints[destination]
+	delete(s.hints, destination)
+	return hints, nil
+}
+
+// Destinations returns the destinations that have hints.
+func (s *MemoryHintStore) Destinations() ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	destinations := make([]string, 0, len(s.hints))
+	for destination := range s.hints {
+		destinations = append(destinations, destination)
+	}
+	return destinations, nil
+}
+
+// substitutes keeps track of the nodes that the writes of a request were
+// handed off to, so that no node stands in for more than one of its owners.
+type substitutes struct {
+	sync.Mutex
+	claimed map[string]bool
+}
+
+func newSubstitutes() *substitutes {
+	return &substitutes{
+		claimed: make(map[string]bool),
+	}
+}
+
+// claim reserves the node as a substitute and returns whether it was not
+// claimed before. A node stays claimed even when the write it was handed
+// fails.
+func (s *substitutes) claim(node string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.claimed[node] {
+		return false
+	}
+	s.claimed[node] = true
+	return true
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryHintStore(t *testing.T) {
+	store := NewMemoryHintStore(0)
+	assert.NoError(t, store.Store(Hint{Destination: "127.0.0.1:3002", Keys: []string{"a"}}))
+	assert.NoError(t, store.Store(Hint{Destination: "127.0.0.1:3002", Keys: []string{"b"}}))
+	assert.NoError(t, store.Store(Hint{Destination: "127.0.0.1:3003", Keys: []string{"c"}}))
+
+	destinations, err := store.Destinations()
+	assert.NoError(t, err)
+	assert.Len(t, destinations, 2)
+	assert.Contains(t, destinations, "127.0.0.1:3002")
+	assert.Contains(t, destinations, "127.0.0.1:3003")
+
+	hints, err := store.Take("127.0.0.1:3002")
+	assert.NoError(t, err)
+	assert.Equal(t, []Hint{
+		{Destination: "127.0.0.1:3002", Keys: []string{"a"}},
+		{Destination: "127.0.0.1:3002", Keys: []string{"b"}},
+	}, hints)
+
+	hints, err = store.Take("127.0.0.1:3002")
+	assert.NoError(t, err)
+	assert.Empty(t, hints, "expected hints to be removed when taken")
+
+	destinations, err = store.Destinations()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3003"}, destinations)
+}
+
+func TestMemoryHintStoreMax(t *testing.T) {
+	store := NewMemoryHintStore(2)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, store.Store(Hint{Destination: "127.0.0.1:3002", Keys: []string{key}}))
+	}
+
+	hints, err := store.Take("127.0.0.1:3002")
+	assert.NoError(t, err)
+	assert.Equal(t, []Hint{
+		{Destination: "127.0.0.1:3002", Keys: []string{"b"}},
+		{Destination: "127.0.0.1:3002", Keys: []string{"c"}},
+	}, hints, "expected the oldest hint to be dropped")
+}
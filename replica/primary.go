@@ -0,0 +1,175 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/ringpop-go/swim"
+	"golang.org/x/net/context"
+)
+
+// ErrPrimaryFailed is the error of the backups that were skipped because the
+// write did not succeed on the primaries of its keys.
+var ErrPrimaryFailed = errors.New("write failed on primary")
+
+// ErrPrimariesDiffer is returned for writes in PrimaryBackup mode whose keys
+// have different primaries. The primary of one key may be a backup of another
+// key, which would receive the write before the primary of that key did.
+var ErrPrimariesDiffer = errors.New("keys of a primary-backup write have different primaries")
+
+// memberHealth keeps track of the members that SWIM reports as suspect,
+// faulty or leaving, so they can be passed over as primaries.
+type memberHealth struct {
+	sync.Mutex
+	unhealthy map[string]bool
+}
+
+func newMemberHealth() *memberHealth {
+	return &memberHealth{
+		unhealthy: make(map[string]bool),
+	}
+}
+
+// update applies the status changes of members.
+func (h *memberHealth) update(changes []swim.Change) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, change := range changes {
+		switch change.Status {
+		case swim.Alive:
+			delete(h.unhealthy, change.Address)
+		case swim.Suspect, swim.Faulty, swim.Leave, swim.Tombstone:
+			h.unhealthy[change.Address] = true
+		}
+	}
+}
+
+// healthy returns whether the member is considered alive.
+func (h *memberHealth) healthy(address string) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	return !h.unhealthy[address]
+}
+
+// primaries returns the primary of every key: the first replica in its
+// preference list that is alive, or the first replica when none of them is.
+// The primaries are returned in the order of the keys without duplicates.
+func (r *Replicator) primaries(keys []string, destsByKey map[string][]string) []string {
+	var primaries []string
+	seen := make(map[string]bool)
+
+	for _, key := range keys {
+		dests := destsByKey[key]
+		if len(dests) == 0 {
+			continue
+		}
+
+		primary := dests[0]
+		for _, dest := range dests {
+			if r.health.healthy(dest) {
+				primary = dest
+				break
+			}
+		}
+
+		if !seen[primary] {
+			seen[primary] = true
+			primaries = append(primaries, primary)
+		}
+	}
+
+	return primaries
+}
+
+// primaryBackup sends a write to the primary of its keys first, and only
+// propagates it to the backups once the primary acknowledged it. Reads are
+// sent to the primaries alone when they are pinned, and fan out in parallel
+// otherwise.
+func (r *Replicator) primaryBackup(ctx context.Context, rw int, result *Result, copts *callOptions,
+	fopts *forward.Options, opts *Options) {
+
+	if rw == read && opts.ReadPrimary != Enabled {
+		r.parallel(ctx, result, copts, fopts, opts)
+		return
+	}
+
+	primaries := r.primaries(copts.Keys, result.destsByKey)
+	isPrimary := make(map[string]bool, len(primaries))
+	for _, primary := range primaries {
+		isPrimary[primary] = true
+	}
+
+	var backups []string
+	for _, dest := range copts.Dests {
+		if !isPrimary[dest] {
+			backups = append(backups, dest)
+		}
+	}
+
+	// every primary has to respond before the backups are written to
+	primaryOpts := *copts
+	primaryOpts.Dests = primaries
+	waitOpts := *opts
+	waitOpts.EarlyReturn = Disabled
+	r.parallel(ctx, result, &primaryOpts, fopts, &waitOpts)
+
+	if rw == read {
+		return
+	}
+
+	if result.count(Succeeded) < len(primaries) {
+		for _, backup := range backups {
+			result.skip(backup, copts.KeysByDest[backup], ErrPrimaryFailed)
+		}
+		return
+	}
+
+	if opts.AsyncBackups == Enabled {
+		for _, backup := range backups {
+			result.skip(backup, copts.KeysByDest[backup], nil)
+			go r.propagate(detachedContext{ctx}, backup, copts, fopts)
+		}
+		return
+	}
+
+	backupOpts := *copts
+	backupOpts.Dests = backups
+	r.parallel(ctx, result, &backupOpts, fopts, opts)
+}
+
+// propagate writes to a backup in the background and emits the outcome as a
+// BackupCompletedEvent.
+func (r *Replicator) propagate(ctx context.Context, backup string, copts *callOptions,
+	fopts *forward.Options) {
+
+	_, err := r.replicate(ctx, backup, copts, fopts)
+	r.emit(BackupCompletedEvent{
+		Destination: backup,
+		Keys:        copts.KeysByDest[backup],
+		Operation:   copts.Operation,
+		Err:         err,
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/hashring"
+	"github.com/uber/ringpop-go/swim"
+)
+
+func TestMemberHealth(t *testing.T) {
+	health := newMemberHealth()
+	assert.True(t, health.healthy("127.0.0.1:3001"))
+
+	health.update([]swim.Change{
+		{Address: "127.0.0.1:3001", Status: swim.Suspect},
+		{Address: "127.0.0.1:3002", Status: swim.Faulty},
+	})
+	assert.False(t, health.healthy("127.0.0.1:3001"))
+	assert.False(t, health.healthy("127.0.0.1:3002"))
+
+	health.update([]swim.Change{{Address: "127.0.0.1:3001", Status: swim.Alive}})
+	assert.True(t, health.healthy("127.0.0.1:3001"))
+}
+
+func TestPrimaries(t *testing.T) {
+	r := &Replicator{health: newMemberHealth()}
+	destsByKey := map[string][]string{
+		"a": {"127.0.0.1:3001", "127.0.0.1:3002"},
+		"b": {"127.0.0.1:3001", "127.0.0.1:3003"},
+		"c": {"127.0.0.1:3004", "127.0.0.1:3001"},
+	}
+
+	keys := []string{"a", "b", "c"}
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3004"}, r.primaries(keys, destsByKey))
+
+	r.health.update([]swim.Change{{Address: "127.0.0.1:3001", Status: swim.Faulty}})
+	assert.Equal(t, []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}, r.primaries(keys, destsByKey))
+
+	r.health.update([]swim.Change{{Address: "127.0.0.1:3004", Status: swim.Faulty}})
+	assert.Equal(t, []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}, r.primaries(keys, destsByKey),
+		"expected the first replica when none of the replicas is alive")
+}
+
+// hashringSender is a Sender that looks up keys in a real HashRing.
+type hashringSender struct {
+	dummySender
+	ring *hashring.HashRing
+}
+
+func (h hashringSender) LookupN(key string, n int) ([]string, error) {
+	return h.ring.LookupN(key, n), nil
+}
+
+// TestPrimariesHashRing tests that the primary of a key is its owner on the
+// ring, and that the next replica in ring order takes over when it fails.
+func TestPrimariesHashRing(t *testing.T) {
+	ring := hashring.New(farm.Fingerprint32, 100)
+	for i := 1; i <= 10; i++ {
+		ring.AddServer(fmt.Sprintf("127.0.0.1:%d", 3000+i))
+	}
+
+	r := &Replicator{sender: hashringSender{ring: ring}, health: newMemberHealth()}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owner, _ := ring.Lookup(key)
+
+		for j := 0; j < 10; j++ {
+			destsByKey, _ := r.groupReplicas([]string{key}, 3)
+			assert.Equal(t, []string{owner}, r.primaries([]string{key}, destsByKey),
+				"expected the owner of the key to be its primary on every call")
+		}
+	}
+
+	key := "key0"
+	dests := ring.LookupN(key, 3)
+	r.health.update([]swim.Change{{Address: dests[0], Status: swim.Faulty}})
+
+	destsByKey, _ := r.groupReplicas([]string{key}, 3)
+	assert.Equal(t, []string{dests[1]}, r.primaries([]string{key}, destsByKey),
+		"expected the next replica on the ring to take over from a failed owner")
+}
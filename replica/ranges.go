@@ -0,0 +1,214 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"sort"
+	"sync"
+
+	log "github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/hashring"
+	"github.com/uber/ringpop-go/logging"
+)
+
+// A RangeSource divides the ring into ranges of hashes that are replicated by
+// the same servers. Ringpop is a RangeSource.
+type RangeSource interface {
+	// WhoAmI should return the address of the local node
+	WhoAmI() (string, error)
+
+	// ReplicaRanges should return the ranges of the ring that are replicated
+	// by the same n servers
+	ReplicaRanges(n int) ([]hashring.ReplicaRange, error)
+}
+
+// A RangeChange is a range of hashes whose replicas changed. The range runs
+// from Start, exclusive, to End, inclusive, and wraps around the ring when
+// Start is not smaller than End. The replica sets are sorted.
+type RangeChange struct {
+	Start       int
+	End         int
+	OldReplicas []string
+	NewReplicas []string
+}
+
+// A RangeListener is notified when the local node becomes or stops being one
+// of the replicas of a range. The methods are called one change at a time,
+// while the RangeWatcher is locked, so they must not update the RangeWatcher.
+type RangeListener interface {
+	// AcquireRange is called when the local node became a replica of the
+	// range, the data of the range can be streamed from OldReplicas.
+	AcquireRange(change RangeChange)
+
+	// ReleaseRange is called when the local node is no longer a replica of
+	// the range, the data of the range can be streamed to NewReplicas.
+	ReleaseRange(change RangeChange)
+}
+
+// A RangeWatcher follows the changes of the ring and notifies its listener of
+// the ranges the local node acquires and releases as one of N replicas.
+// Register the RangeWatcher as a listener of Ringpop to follow the ring.
+type RangeWatcher struct {
+	source   RangeSource
+	n        int
+	listener RangeListener
+	logger   log.Logger
+
+	sync.Mutex
+	ranges []hashring.ReplicaRange
+}
+
+// NewRangeWatcher returns a RangeWatcher for ranges that are replicated by n
+// servers. The first update acquires all ranges the local node replicates.
+func NewRangeWatcher(source RangeSource, n int, listener RangeListener) *RangeWatcher {
+	return &RangeWatcher{
+		source:   source,
+		n:        n,
+		listener: listener,
+		logger:   logging.Logger("rangewatcher"),
+	}
+}
+
+// HandleEvent updates the ranges when the ring changed.
+func (w *RangeWatcher) HandleEvent(event events.Event) {
+	if _, ok := event.(events.RingChangedEvent); ok {
+		if err := w.Update(); err != nil {
+			w.logger.WithField("error", err).Warn("range watcher unable to update ranges")
+		}
+	}
+}
+
+// Update compares the ranges of the ring with the ranges of the previous
+// update and notifies the listener of the ranges the local node acquired and
+// released in between. Updates are serialized, and every update reads the
+// ring while it holds the lock, so concurrent updates never diff a newer ring
+// back to an older one.
+func (w *RangeWatcher) Update() error {
+	w.Lock()
+	defer w.Unlock()
+
+	local, err := w.source.WhoAmI()
+	if err != nil {
+		return err
+	}
+
+	ranges, err := w.source.ReplicaRanges(w.n)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range diffRanges(w.ranges, ranges) {
+		was := containsString(change.OldReplicas, local)
+		is := containsString(change.NewReplicas, local)
+
+		switch {
+		case is && !was:
+			w.listener.AcquireRange(change)
+		case was && !is:
+			w.listener.ReleaseRange(change)
+		}
+	}
+
+	w.ranges = ranges
+	return nil
+}
+
+// diffRanges returns the ranges whose replicas differ between the ranges of
+// the ring before and after a change. Adjacent changes with the same replica
+// sets are merged.
+func diffRanges(before, after []hashring.ReplicaRange) []RangeChange {
+	var bounds []int
+	for _, r := range before {
+		bounds = append(bounds, r.End)
+	}
+	for _, r := range after {
+		bounds = append(bounds, r.End)
+	}
+	sort.Ints(bounds)
+
+	var changes []RangeChange
+	for i, end := range bounds {
+		if i > 0 && bounds[i-1] == end {
+			continue
+		}
+
+		oldReplicas := replicasAt(before, end)
+		newReplicas := replicasAt(after, end)
+		if equalStrings(oldReplicas, newReplicas) {
+			continue
+		}
+
+		if last := len(changes) - 1; last >= 0 && i > 0 && changes[last].End == bounds[i-1] &&
+			equalStrings(changes[last].OldReplicas, oldReplicas) &&
+			equalStrings(changes[last].NewReplicas, newReplicas) {
+			changes[last].End = end
+			continue
+		}
+
+		start := bounds[len(bounds)-1]
+		if i > 0 {
+			start = bounds[i-1]
+		}
+		changes = append(changes, RangeChange{
+			Start:       start,
+			End:         end,
+			OldReplicas: oldReplicas,
+			NewReplicas: newReplicas,
+		})
+	}
+	return changes
+}
+
+// replicasAt returns the replicas of the range that contains the hash.
+func replicasAt(ranges []hashring.ReplicaRange, hash int) []string {
+	if len(ranges) == 0 {
+		return nil
+	}
+	for _, r := range ranges {
+		if hash <= r.End {
+			return r.Replicas
+		}
+	}
+	// the hash is in the range that wraps around the ring
+	return ranges[0].Replicas
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/hashring"
+)
+
+// ringSource is a RangeSource backed by a hashring.
+type ringSource struct {
+	local string
+	ring  *hashring.HashRing
+}
+
+func (r ringSource) WhoAmI() (string, error) {
+	return r.local, nil
+}
+
+func (r ringSource) ReplicaRanges(n int) ([]hashring.ReplicaRange, error) {
+	return r.ring.ReplicaRanges(n), nil
+}
+
+type recordingRangeListener struct {
+	acquired, released []RangeChange
+}
+
+func (l *recordingRangeListener) AcquireRange(change RangeChange) {
+	l.acquired = append(l.acquired, change)
+}
+
+func (l *recordingRangeListener) ReleaseRange(change RangeChange) {
+	l.released = append(l.released, change)
+}
+
+func inRange(change RangeChange, hash int) bool {
+	if change.Start < change.End {
+		return hash > change.Start && hash <= change.End
+	}
+	return hash > change.Start || hash <= change.End
+}
+
+func TestDiffRanges(t *testing.T) {
+	before := []hashring.ReplicaRange{
+		{Start: 30, End: 10, Replicas: []string{"a"}},
+		{Start: 10, End: 30, Replicas: []string{"b"}},
+	}
+	after := []hashring.ReplicaRange{
+		{Start: 30, End: 10, Replicas: []string{"a"}},
+		{Start: 10, End: 20, Replicas: []string{"c"}},
+		{Start: 20, End: 30, Replicas: []string{"b"}},
+	}
+
+	assert.Equal(t, []RangeChange{
+		{Start: 10, End: 20, OldReplicas: []string{"b"}, NewReplicas: []string{"c"}},
+	}, diffRanges(before, after))
+	assert.Empty(t, diffRanges(after, after))
+}
+
+func TestRangeWatcher(t *testing.T) {
+	ring := hashring.New(farm.Fingerprint32, 10)
+	ring.AddServer("a")
+
+	listener := &recordingRangeListener{}
+	watcher := NewRangeWatcher(ringSource{"a", ring}, 1, listener)
+
+	assert.NoError(t, watcher.Update())
+	assert.Len(t, listener.acquired, 1, "expected the whole ring to be acquired")
+	assert.Nil(t, listener.acquired[0].OldReplicas)
+	assert.Equal(t, []string{"a"}, listener.acquired[0].NewReplicas)
+	assert.Empty(t, listener.released)
+
+	ring.AddServer("b")
+	assert.NoError(t, watcher.Update())
+	assert.Len(t, listener.acquired, 1, "expected no ranges to be acquired")
+	assert.NotEmpty(t, listener.released)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		hash := int(farm.Fingerprint32([]byte(key)))
+		owner, _ := ring.Lookup(key)
+
+		released := false
+		for _, change := range listener.released {
+			if inRange(change, hash) {
+				released = true
+				assert.Equal(t, []string{"a"}, change.OldReplicas)
+				assert.Equal(t, []string{"b"}, change.NewReplicas)
+			}
+		}
+		assert.Equal(t, owner == "b", released, "expected the ranges of key %s to be released to its new owner", key)
+	}
+}
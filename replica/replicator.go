@@ -23,15 +23,21 @@
 package replica
 
 import (
+	"bytes"
 	"errors"
 	"sync"
+	"time"
 
 	log "github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/events"
 	"github.com/uber/ringpop-go/forward"
 	"github.com/uber/ringpop-go/logging"
 	"github.com/uber/ringpop-go/shared"
+	"github.com/uber/ringpop-go/swim"
 	"github.com/uber/ringpop-go/util"
 	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/json"
+	"golang.org/x/net/context"
 )
 
 // FanoutMode defines how a replicator should fanout it's requests
@@ -49,6 +55,56 @@ const (
 	// SerialBalanced fanout mode for replicator read write requests. Sends out
 	// requests one at a time, going through the preference list in a random order
 	SerialBalanced
+
+	// PrimaryBackup fanout mode for replicator read write requests. Sends out
+	// writes to the primary of their keys first, the first replica in the
+	// preference list that SWIM does not report as suspect or faulty, and
+	// propagates them to the backups once the primary succeeded. Writes of
+	// keys with different primaries are rejected with ErrPrimariesDiffer.
+	// Reads fan out in parallel unless they are pinned to the primaries.
+	PrimaryBackup
+)
+
+// A Toggle turns an option of a request on or off. Its zero value keeps the
+// setting of the options the replicator was created with.
+type Toggle int
+
+const (
+	// Unset keeps the setting the replicator was created with, which is off
+	// when it was not set either.
+	Unset Toggle = iota
+
+	// Enabled turns the option on.
+	Enabled
+
+	// Disabled turns the option off.
+	Disabled
+)
+
+func selectToggle(opt, def Toggle) Toggle {
+	if opt == Unset {
+		return def
+	}
+	return opt
+}
+
+// StragglerPolicy defines what happens to the replicated calls that are still
+// in flight when a request with early return completes. Its zero value keeps
+// the policy the replicator was created with, which cancels the stragglers
+// when it was not set either.
+type StragglerPolicy int
+
+const (
+	// CancelStragglers cancels the calls that are still in flight when the
+	// request completes.
+	CancelStragglers StragglerPolicy = iota + 1
+
+	// DetachStragglers lets the calls that are still in flight finish in the
+	// background, which is useful for the durability of writes. The outcome
+	// of every straggler is emitted as a StragglerCompletedEvent. Detached
+	// calls are not cancelled with the context of the caller; they are only
+	// bound by the timeout of the forward options.
+	DetachStragglers
 )
 
 const (
@@ -79,8 +135,86 @@ type Response struct {
 type Options struct {
 	NValue, RValue, WValue int
 	FanoutMode             FanoutMode
+
+	// EarlyReturn completes a request as soon as the R or W value is
+	// satisfied, or as soon as it can no longer be satisfied, instead of
+	// waiting for every destination. Serial fanout stops sending requests at
+	// that point; parallel fanout handles the remaining calls according to
+	// the StragglerPolicy.
+	EarlyReturn Toggle
+	Stragglers  StragglerPolicy
+
+	// Resolver reconciles the responses of ReadResolved into a single value.
+	// It defaults to FirstNonEmpty.
+	Resolver Resolver
+
+	// ReadRepair builds the request that writes the resolved value of
+	// ReadResolved back to the replicas that responded with a different
+	// value. Read repair is disabled when it is not set.
+	ReadRepair RepairFunc
+
+	// HintedHandoff enables sloppy quorum writes. A write that fails to reach
+	// one of the owners of its keys is handed off to the next node on the
+	// ring that accepts it, which counts towards the W value. The substitute
+	// keeps a hint in the hint store of its replicator and replays the write
+	// to the owner once it is alive again. Writes are not handed off when the
+	// caller gave up on them, or when early return cancelled them.
+	HintedHandoff Toggle
+
+	// HandoffRelease builds the request that removes the keys of a write
+	// that was handed off to the local node, once the write was replayed to
+	// its owner. Keys the local node owns by then are kept. It is only used
+	// from the options the replicator is created with; handed off writes are
+	// kept when it is not set.
+	HandoffRelease ReleaseFunc
+
+	// Format is the format of the replicated requests, such as tchannel.JSON
+	// or tchannel.Thrift.
+	Format tchannel.Format
+
+	// Service is the service the replicated requests are sent to. It
+	// defaults to the service name of the replicator's SubChannel.
+	Service string
+
+	// Timeout limits every replicated call, including its retries. It is
+	// applied on top of the deadline of the caller's context.
+	Timeout time.Duration
+
+	// RequestBuilder builds the request for every destination from the keys
+	// it replicates, so destinations only receive their subset of the keys.
+	// The request passed to Read or Write is ignored when it is set.
+	RequestBuilder forward.RequestBuilder
+
+	// AsyncBackups propagates writes in PrimaryBackup mode to the backups in
+	// the background, so a write is acknowledged by its primaries alone. The
+	// outcome of every backup is emitted as a BackupCompletedEvent.
+	AsyncBackups Toggle
+
+	// ReadPrimary pins reads in PrimaryBackup mode to the primaries of their
+	// keys, so a read is satisfied by its primaries alone.
+	ReadPrimary Toggle
 }
 
+// defaultMaxHints is the number of hints per destination that are kept by the
+// default hint store.
+const defaultMaxHints = 1000
+
+// A RepairFunc returns the request that writes the value to a replica that
+// owns the keys, and the operation that handles the request.
+type RepairFunc func(keys []string, value []byte) (request []byte, operation string, err error)
+
+// A ReleaseFunc returns the request that removes the keys of a handed off
+// write from the local node, and the operation that handles the request.
+type ReleaseFunc func(keys []string) (request []byte, operation string, err error)
+
+// hintEndpoint is the endpoint that stores the hints of the writes that were
+// handed off to the local node.
+const hintEndpoint = "/replica/hint"
+
+// defaultHintTimeout limits the call that stores a hint on a substitute when
+// the request has no timeout.
+const defaultHintTimeout = time.Second
+
 type callOptions struct {
 	Keys       []string
 	Dests      []string
@@ -88,6 +222,27 @@ type callOptions struct {
 	KeysByDest map[string][]string
 	Operation  string
 	Format     tchannel.Format
+	Service    string
+	Timeout    time.Duration
+
+	// Build builds the request for every destination when it is set
+	Build forward.RequestBuilder
+
+	// HintedHandoff is set for writes that are handed off when they fail
+	HintedHandoff bool
+	NValue        int
+
+	// Substitutes are the nodes writes of the request were handed off to,
+	// shared by every copy of the options
+	Substitutes *substitutes
+}
+
+// request returns the request for the destination.
+func (c *callOptions) request(dest string) ([]byte, error) {
+	if c.Build == nil {
+		return c.Request, nil
+	}
+	return c.Build(dest, c.KeysByDest[dest])
 }
 
 // A Replicator is used to replicate a request across nodes such that they share
@@ -98,11 +253,19 @@ type Replicator struct {
 	forwarder *forward.Forwarder
 	logger    log.Logger
 	defaults  *Options
+
+	hints  HintStore
+	health *memberHealth
+
+	listeners []events.EventListener
+
+	sync.Mutex
+	stopReplay chan struct{}
 }
 
 func selectFanoutMode(mode FanoutMode) FanoutMode {
 	switch mode {
-	case Parallel, SerialSequential, SerialBalanced:
+	case Parallel, SerialSequential, SerialBalanced, PrimaryBackup:
 		return mode
 	default:
 		return Parallel
@@ -120,25 +283,177 @@ func mergeDefaultOptions(opts *Options, def *Options) *Options {
 	merged.RValue = util.SelectInt(opts.RValue, def.RValue)
 	merged.WValue = util.SelectInt(opts.WValue, def.WValue)
 	merged.FanoutMode = selectFanoutMode(opts.FanoutMode)
+	merged.EarlyReturn = selectToggle(opts.EarlyReturn, def.EarlyReturn)
+	merged.Stragglers = opts.Stragglers
+	if merged.Stragglers == 0 {
+		merged.Stragglers = def.Stragglers
+	}
+	merged.Resolver = opts.Resolver
+	if merged.Resolver == nil {
+		merged.Resolver = def.Resolver
+	}
+	merged.ReadRepair = opts.ReadRepair
+	if merged.ReadRepair == nil {
+		merged.ReadRepair = def.ReadRepair
+	}
+	merged.HintedHandoff = selectToggle(opts.HintedHandoff, def.HintedHandoff)
+	merged.HandoffRelease = opts.HandoffRelease
+	if merged.HandoffRelease == nil {
+		merged.HandoffRelease = def.HandoffRelease
+	}
+	merged.Format = opts.Format
+	if merged.Format == "" {
+		merged.Format = def.Format
+	}
+	merged.Service = opts.Service
+	if merged.Service == "" {
+		merged.Service = def.Service
+	}
+	merged.Timeout = util.SelectDuration(opts.Timeout, def.Timeout)
+	merged.RequestBuilder = opts.RequestBuilder
+	if merged.RequestBuilder == nil {
+		merged.RequestBuilder = def.RequestBuilder
+	}
+	merged.AsyncBackups = selectToggle(opts.AsyncBackups, def.AsyncBackups)
+	merged.ReadPrimary = selectToggle(opts.ReadPrimary, def.ReadPrimary)
 
 	return &merged
 }
 
 // NewReplicator returns a new Replicator instance that makes calls with the given
 // SubChannel to the service defined by SubChannel.GetServiceName(). The given n/w/r
-// values will be used as defaults for the replicator when none are provided
+// values will be used as defaults for the replicator when none are provided. The
+// forwarder options configure the forwarder used to send the replicated requests,
+// e.g. to trace them. The replicator accepts the hints of the writes other
+// replicators hand off to the local node on the SubChannel.
 // Deprecation: logger is no longer used.
 func NewReplicator(s Sender, channel shared.SubChannel, logger log.Logger,
-	opts *Options) *Replicator {
+	opts *Options, forwarderOpts ...forward.ForwarderOption) *Replicator {
 
-	f := forward.NewForwarder(s, channel)
+	f := forward.NewForwarder(s, channel, forwarderOpts...)
 
-	opts = mergeDefaultOptions(opts, &Options{3, 1, 3, Parallel})
+	opts = mergeDefaultOptions(opts, &Options{
+		NValue:     3,
+		RValue:     1,
+		WValue:     3,
+		FanoutMode: Parallel,
+	})
 	logger = logging.Logger("replicator")
 	if identity, err := s.WhoAmI(); err == nil {
 		logger = logger.WithField("local", identity)
 	}
-	return &Replicator{s, channel, f, logger, opts}
+	r := &Replicator{
+		sender:    s,
+		channel:   channel,
+		forwarder: f,
+		logger:    logger,
+		defaults:  opts,
+		hints:     NewMemoryHintStore(defaultMaxHints),
+		health:    newMemberHealth(),
+	}
+
+	handlers := map[string]interface{}{
+		hintEndpoint: r.hintHandler,
+	}
+	err := json.Register(channel, handlers, func(ctx context.Context, err error) {
+		r.logger.WithField("error", err).Info("error occured")
+	})
+	if err != nil {
+		r.logger.WithField("error", err).Warn("replicator unable to register hint endpoint")
+	}
+
+	return r
+}
+
+// SetHintStore sets the store that keeps the hints of handed off writes. It
+// replaces the in-memory store the replicator is created with, and should be
+// called before the replicator is used.
+func (r *Replicator) SetHintStore(store HintStore) {
+	r.hints = store
+}
+
+// StartHintReplay replays the hints of every destination that is not suspect
+// or faulty periodically, until StopHintReplay is called. Hints are replayed
+// as well when SWIM reports their destination alive.
+func (r *Replicator) StartHintReplay(interval time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.stopReplay != nil {
+		return
+	}
+	r.stopReplay = make(chan struct{})
+	go r.runHintReplay(interval, r.stopReplay)
+}
+
+// StopHintReplay stops the periodic replay of hints. A replay that is in
+// progress runs to completion.
+func (r *Replicator) StopHintReplay() {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.stopReplay == nil {
+		return
+	}
+	close(r.stopReplay)
+	r.stopReplay = nil
+}
+
+func (r *Replicator) runHintReplay(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			destinations, err := r.hints.Destinations()
+			if err != nil {
+				r.logger.WithField("error", err).Warn("replicator unable to list hint destinations")
+				continue
+			}
+
+			for _, dest := range destinations {
+				if r.health.healthy(dest) {
+					r.replayHints(dest)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// HandleEvent replays the hints of members that SWIM reports alive and keeps
+// track of the members that are suspect or faulty. Register the replicator as
+// a listener of Ringpop to replay hints of handed off writes and to fail over
+// primaries in PrimaryBackup mode.
+func (r *Replicator) HandleEvent(event events.Event) {
+	changes, ok := event.(swim.MemberlistChangesAppliedEvent)
+	if !ok {
+		return
+	}
+
+	r.health.update(changes.Changes)
+
+	for _, change := range changes.Changes {
+		if change.Status == swim.Alive {
+			go r.replayHints(change.Address)
+		}
+	}
+}
+
+func (r *Replicator) emit(event events.Event) {
+	for _, listener := range r.listeners {
+		go listener.HandleEvent(event)
+	}
+}
+
+// RegisterListener adds a listener to the replicator. The listener's
+// HandleEvent will be called for every emit on Replicator. The HandleEvent
+// method must be thread safe. Register Ringpop as a listener to record the
+// stats of replicated requests.
+func (r *Replicator) RegisterListener(l events.EventListener) {
+	r.listeners = append(r.listeners, l)
 }
 
 // Read replicates a read request. It takes key(s) to be used for lookup of the requests
@@ -150,8 +465,107 @@ func NewReplicator(s Sender, channel shared.SubChannel, logger log.Logger,
 func (r *Replicator) Read(keys []string, request []byte, operation string, fopts *forward.Options,
 	opts *Options) (responses []Response, err error) {
 
+	return r.ReadContext(context.Background(), keys, request, operation, fopts, opts)
+}
+
+// ReadContext is like Read but takes the context of the caller. The deadline
+// and cancellation of the context apply to every replicated call.
+func (r *Replicator) ReadContext(ctx context.Context, keys []string, request []byte, operation string,
+	fopts *forward.Options, opts *Options) (responses []Response, err error) {
+
+	result, err := r.ReadResult(ctx, keys, request, operation, fopts, opts)
+	return result.responses(), err
+}
+
+// ReadResult is like ReadContext but returns the outcome of the request for
+// every destination. When the R value is not satisfied the error is a
+// *QuorumError and the result is returned along with it.
+func (r *Replicator) ReadResult(ctx context.Context, keys []string, request []byte, operation string,
+	fopts *forward.Options, opts *Options) (*Result, error) {
+
 	opts = mergeDefaultOptions(opts, r.defaults)
-	return r.readWrite(read, keys, request, operation, fopts, opts)
+	return r.readWrite(ctx, read, keys, request, operation, fopts, opts)
+}
+
+// ReadResolved is like Read but reconciles the responses into a single value
+// with the Resolver of the options. When read repair is enabled, the value is
+// written back asynchronously to the replicas that responded with a different
+// value, and the outcome of every repair is emitted as a ReadRepairEvent.
+// The responses of a read of multiple keys can only be reconciled when every
+// replica that responded holds all of the keys; otherwise ErrKeysDiffer is
+// returned.
+func (r *Replicator) ReadResolved(keys []string, request []byte, operation string, fopts *forward.Options,
+	opts *Options) ([]byte, error) {
+
+	return r.ReadResolvedContext(context.Background(), keys, request, operation, fopts, opts)
+}
+
+// ReadResolvedContext is like ReadResolved but takes the context of the
+// caller. The deadline and cancellation of the context apply to every
+// replicated call, but not to the read repairs.
+func (r *Replicator) ReadResolvedContext(ctx context.Context, keys []string, request []byte, operation string,
+	fopts *forward.Options, opts *Options) ([]byte, error) {
+
+	opts = mergeDefaultOptions(opts, r.defaults)
+	result, err := r.readWrite(ctx, read, keys, request, operation, fopts, opts)
+	if err != nil {
+		return nil, err
+	}
+	responses := result.Responses()
+
+	for _, response := range responses {
+		if !equalStrings(response.Keys, responses[0].Keys) {
+			return nil, ErrKeysDiffer
+		}
+	}
+
+	resolver := opts.Resolver
+	if resolver == nil {
+		resolver = FirstNonEmpty
+	}
+
+	value, err := resolver.Resolve(responses)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ReadRepair != nil {
+		r.readRepair(ctx, value, responses, fopts, opts)
+	}
+
+	return value, nil
+}
+
+// readRepair writes the value to the replicas whose response differs from it.
+// Replicas that did not respond are not repaired.
+func (r *Replicator) readRepair(ctx context.Context, value []byte, responses []Response,
+	fopts *forward.Options, opts *Options) {
+
+	for _, response := range responses {
+		if bytes.Equal(response.Body, value) {
+			continue
+		}
+
+		go func(dest string, keys []string) {
+			request, operation, err := opts.ReadRepair(keys, value)
+			if err == nil {
+				_, err = r.forwardRequest(detachedContext{ctx}, dest, &callOptions{
+					Request:    request,
+					Operation:  operation,
+					KeysByDest: map[string][]string{dest: keys},
+					Format:     opts.Format,
+					Service:    opts.Service,
+					Timeout:    opts.Timeout,
+				}, fopts)
+			}
+
+			r.emit(ReadRepairEvent{
+				Destination: dest,
+				Keys:        keys,
+				Err:         err,
+			})
+		}(response.Destination, response.Keys)
+	}
 }
 
 // Write replicates a write request. It takes key(s) to be used for lookup of the requests
@@ -163,8 +577,26 @@ func (r *Replicator) Read(keys []string, request []byte, operation string, fopts
 func (r *Replicator) Write(keys []string, request []byte, operation string, fopts *forward.Options,
 	opts *Options) (responses []Response, err error) {
 
+	return r.WriteContext(context.Background(), keys, request, operation, fopts, opts)
+}
+
+// WriteContext is like Write but takes the context of the caller. The deadline
+// and cancellation of the context apply to every replicated call.
+func (r *Replicator) WriteContext(ctx context.Context, keys []string, request []byte, operation string,
+	fopts *forward.Options, opts *Options) (responses []Response, err error) {
+
+	result, err := r.WriteResult(ctx, keys, request, operation, fopts, opts)
+	return result.responses(), err
+}
+
+// WriteResult is like WriteContext but returns the outcome of the request for
+// every destination. When the W value is not satisfied the error is a
+// *QuorumError and the result is returned along with it.
+func (r *Replicator) WriteResult(ctx context.Context, keys []string, request []byte, operation string,
+	fopts *forward.Options, opts *Options) (*Result, error) {
+
 	opts = mergeDefaultOptions(opts, r.defaults)
-	return r.readWrite(write, keys, request, operation, fopts, opts)
+	return r.readWrite(ctx, write, keys, request, operation, fopts, opts)
 }
 
 func (r *Replicator) groupReplicas(keys []string, n int) (map[string][]string,
@@ -190,135 +622,503 @@ func (r *Replicator) groupReplicas(keys []string, n int) (map[string][]string,
 	return destsByKey, keysByDest
 }
 
-func (r *Replicator) readWrite(rw int, keys []string, request []byte, operation string,
-	fopts *forward.Options, opts *Options) ([]Response, error) {
+func (r *Replicator) readWrite(ctx context.Context, rw int, keys []string, request []byte, operation string,
+	fopts *forward.Options, opts *Options) (*Result, error) {
 
 	var rwValue int
+	var method string
 	switch rw {
 	case read:
 		rwValue = opts.RValue
+		method = "read"
 	case write:
 		rwValue = opts.WValue
+		method = "write"
 	}
 
 	if rwValue > opts.NValue {
 		return nil, errors.New("rw value cannot exceed n value")
 	}
 
+	r.emit(RequestStartedEvent{
+		Method:    method,
+		Operation: operation,
+		Keys:      keys,
+	})
+
 	destsByKey, keysByDest := r.groupReplicas(keys, opts.NValue)
+
+	// preserve the preference list order of the keys
 	var dests []string
-	switch len(keys) {
-	case 1:
-		// preserve preference list order
-		dests = destsByKey[keys[0]]
-	default:
-		// else arbitary order
-		for dest := range keysByDest {
-			dests = append(dests, dest)
+	seen := make(map[string]bool, len(keysByDest))
+	for _, key := range keys {
+		for _, dest := range destsByKey[key] {
+			if !seen[dest] {
+				seen[dest] = true
+				dests = append(dests, dest)
+			}
 		}
 	}
 
 	if len(dests) < rwValue {
+		r.emitQuorumFailed(method, operation, keys, keys, rwValue)
 		return nil, errors.New("rw value not satisfied by destination")
 	}
+	for _, key := range keys {
+		if len(destsByKey[key]) < rwValue {
+			r.emitQuorumFailed(method, operation, keys, keys, rwValue)
+			return nil, errors.New("rw value not satisfied by destination")
+		}
+	}
+
+	if opts.FanoutMode == PrimaryBackup && rw == write && len(r.primaries(keys, destsByKey)) > 1 {
+		return nil, ErrPrimariesDiffer
+	}
 
-	var responses []Response
-	var errs []error
+	if opts.FanoutMode == PrimaryBackup {
+		// the primaries alone satisfy pinned reads and asynchronous writes
+		if rw == read && opts.ReadPrimary == Enabled || rw == write && opts.AsyncBackups == Enabled {
+			rwValue = 1
+		}
+	}
 
 	copts := &callOptions{
 		Keys:       keys,
 		Dests:      dests,
 		Request:    request,
+		Build:      opts.RequestBuilder,
 		KeysByDest: keysByDest,
 		Operation:  operation,
+		Format:     opts.Format,
+		Service:    opts.Service,
+		Timeout:    opts.Timeout,
+
+		HintedHandoff: rw == write && opts.HintedHandoff == Enabled,
+		NValue:        opts.NValue,
+		Substitutes:   newSubstitutes(),
 	}
 
+	result := &Result{
+		RWValue:    rwValue,
+		destsByKey: destsByKey,
+	}
+
+	start := time.Now()
 	switch opts.FanoutMode {
 	case Parallel:
-		responses, errs = r.parallel(rwValue, copts, fopts, opts)
+		r.parallel(ctx, result, copts, fopts, opts)
 	case SerialSequential, SerialBalanced:
-		responses, errs = r.serial(rwValue, copts, fopts, opts)
+		r.serial(ctx, result, copts, fopts, opts)
+	case PrimaryBackup:
+		r.primaryBackup(ctx, rw, result, copts, fopts, opts)
+	}
+
+	r.emit(FanoutLatencyEvent{
+		Method:       method,
+		Operation:    operation,
+		Destinations: len(result.Replicas),
+		Duration:     time.Since(start),
+	})
+
+	for _, replica := range result.Replicas {
+		if replica.Outcome == Failed || replica.Outcome == TimedOut {
+			r.emit(DestinationErrorEvent{
+				Method:      method,
+				Operation:   operation,
+				Destination: replica.Destination,
+				Keys:        replica.Keys,
+				Outcome:     replica.Outcome,
+				Err:         replica.Err,
+			})
+		}
 	}
 
-	if len(responses) < rwValue {
+	result.KeysMet, result.KeysMissed = result.quorumByKey(keys)
+
+	if len(result.KeysMissed) > 0 || result.count(Succeeded) < rwValue {
+		errs := result.Errors()
 		r.logger.WithFields(log.Fields{
 			"nValue":       opts.NValue,
 			"rwValue":      rwValue,
-			"numResponses": len(responses),
+			"numResponses": result.count(Succeeded),
 			"numErrors":    len(errs),
 			"errors":       errs,
+			"keysMissed":   result.KeysMissed,
 		}).Debug("replicator rw value not satisfied")
 
-		return responses, errors.New("rw value not satisfied")
+		r.emitQuorumFailed(method, operation, keys, result.KeysMissed, rwValue)
+		return result, &QuorumError{Result: result}
 	}
 
-	return responses, nil
+	r.emit(QuorumMetEvent{
+		Method:    method,
+		Operation: operation,
+		Keys:      keys,
+		RWValue:   rwValue,
+	})
+	return result, nil
+}
+
+func (r *Replicator) emitQuorumFailed(method, operation string, keys, keysMissed []string, rwValue int) {
+	r.emit(QuorumFailedEvent{
+		Method:     method,
+		Operation:  operation,
+		Keys:       keys,
+		KeysMissed: keysMissed,
+		RWValue:    rwValue,
+	})
+}
+
+// A callResult is the outcome of a single replicated call.
+type callResult struct {
+	dest     string
+	response Response
+	err      error
+	latency  time.Duration
 }
 
 // sends read/write requests in parallel
-func (r *Replicator) parallel(rwValue int, copts *callOptions, fopts *forward.Options,
-	opts *Options) ([]Response, []error) {
+func (r *Replicator) parallel(ctx context.Context, result *Result, copts *callOptions, fopts *forward.Options,
+	opts *Options) {
 
-	var responses struct {
-		successes []Response
-		errors    []error
-		sync.Mutex
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if opts.EarlyReturn == Enabled && opts.Stragglers == DetachStragglers {
+		callCtx = detachedContext{ctx}
 	}
 
-	var wg sync.WaitGroup
-
+	results := make(chan callResult, len(copts.Dests))
 	for _, dest := range copts.Dests {
-		wg.Add(1)
 		go func(dest string) {
-			res, err := r.forwardRequest(dest, copts, fopts)
+			start := time.Now()
+			res, err := r.replicate(callCtx, dest, copts, fopts)
+			results <- callResult{dest, res, err, time.Since(start)}
+		}(dest)
+	}
 
-			if err != nil {
-				responses.Lock()
-				responses.errors = append(responses.errors, err)
-				responses.Unlock()
-				wg.Done()
-				return
-			}
+	// without early return the calls are cancelled along with the caller and
+	// report it themselves
+	var done <-chan struct{}
+	if opts.EarlyReturn == Enabled {
+		done = ctx.Done()
+	}
 
-			responses.Lock()
-			responses.successes = append(responses.successes, res)
-			responses.Unlock()
-			wg.Done()
-		}(dest)
+	pending := make(map[string]bool, len(copts.Dests))
+	for _, dest := range copts.Dests {
+		pending[dest] = true
 	}
 
-	wg.Wait()
+	var err error
+collect:
+	for len(pending) > 0 {
+		if opts.EarlyReturn == Enabled && result.decided() {
+			break
+		}
+
+		select {
+		case res := <-results:
+			delete(pending, res.dest)
+			result.add(res.dest, copts.KeysByDest[res.dest], res.response, res.err, res.latency)
+		case <-done:
+			err = ctx.Err()
+			break collect
+		}
+	}
 
-	return responses.successes, responses.errors
+	if len(pending) > 0 {
+		// preserve the order of the destinations
+		for _, dest := range copts.Dests {
+			if pending[dest] {
+				result.skip(dest, copts.KeysByDest[dest], err)
+			}
+		}
+		r.leaveStragglers(results, len(pending), copts, opts)
+	}
 }
 
-func (r *Replicator) serial(rwValue int, copts *callOptions,
-	fopts *forward.Options, opts *Options) ([]Response, []error) {
+// leaveStragglers leaves the pending calls of a request behind. Stragglers
+// are cancelled when the request returns, unless the policy detaches them, in
+// which case the outcome of every straggler is emitted when it completes.
+func (r *Replicator) leaveStragglers(results <-chan callResult, pending int, copts *callOptions,
+	opts *Options) {
 
-	var responses []Response
-	var errors []error
+	if opts.Stragglers != DetachStragglers {
+		return
+	}
+
+	go func() {
+		for i := 0; i < pending; i++ {
+			result := <-results
+			r.emit(StragglerCompletedEvent{
+				Destination: result.dest,
+				Keys:        copts.KeysByDest[result.dest],
+				Operation:   copts.Operation,
+				Err:         result.err,
+			})
+		}
+	}()
+}
+
+func (r *Replicator) serial(ctx context.Context, result *Result, copts *callOptions,
+	fopts *forward.Options, opts *Options) {
 
 	if opts.FanoutMode == SerialBalanced {
 		copts.Dests = util.ShuffleStrings(copts.Dests)
 	}
 
-	for _, dest := range copts.Dests {
-		res, err := r.forwardRequest(dest, copts, fopts)
+	for i, dest := range copts.Dests {
+		// stop sending requests when the outcome is known or the caller gave
+		// up
+		decided := opts.EarlyReturn == Enabled && result.decided()
+		if err := ctx.Err(); decided || err != nil {
+			for _, skipped := range copts.Dests[i:] {
+				result.skip(skipped, copts.KeysByDest[skipped], err)
+			}
+			return
+		}
+
+		start := time.Now()
+		res, err := r.replicate(ctx, dest, copts, fopts)
+		result.add(dest, copts.KeysByDest[dest], res, err, time.Since(start))
+	}
+}
+
+// replicate sends the request to the destination. A write that fails to reach
+// the destination is handed off when hinted handoff is enabled, unless the
+// call was cancelled.
+func (r *Replicator) replicate(ctx context.Context, dest string, copts *callOptions,
+	fopts *forward.Options) (Response, error) {
+
+	res, err := r.forwardRequest(ctx, dest, copts, fopts)
+	if err == nil || !copts.HintedHandoff {
+		return res, err
+	}
+
+	// the caller gave up on the write or early return cut it off, which says
+	// nothing about the destination
+	if ctx.Err() != nil {
+		return res, err
+	}
+
+	// the destination was reached but the application refused the write
+	if _, ok := err.(*forward.ApplicationError); ok {
+		return res, err
+	}
+
+	if res, ok := r.handoff(ctx, dest, copts, fopts); ok {
+		return res, nil
+	}
+	return res, err
+}
+
+// handoff sends a write that failed to reach its destination to the next
+// healthy node on the ring that accepts it along with a hint, which the
+// substitute keeps to replay the write to the destination. Substitutes are
+// chosen in ring order from the first key of the destination, and never
+// include the owners of the request or nodes that already stand in for
+// another owner of the request.
+func (r *Replicator) handoff(ctx context.Context, dest string, copts *callOptions,
+	fopts *forward.Options) (Response, bool) {
+
+	keys := copts.KeysByDest[dest]
+	if len(keys) == 0 {
+		return Response{}, false
+	}
+
+	candidates, err := r.sender.LookupN(keys[0], 2*copts.NValue)
+	if err != nil {
+		return Response{}, false
+	}
+
+	owners := make(map[string]bool, len(copts.KeysByDest))
+	for owner := range copts.KeysByDest {
+		owners[owner] = true
+	}
+
+	request, err := copts.request(dest)
+	if err != nil {
+		return Response{}, false
+	}
+
+	substituteOpts := *copts
+	for _, substitute := range candidates {
+		if owners[substitute] || !r.health.healthy(substitute) {
+			continue
+		}
+		if !copts.Substitutes.claim(substitute) {
+			continue
+		}
+
+		substituteOpts.KeysByDest = map[string][]string{substitute: keys}
+		res, err := r.forwardRequest(ctx, substitute, &substituteOpts, fopts)
 		if err != nil {
-			errors = append(errors, err)
 			continue
 		}
-		responses = append(responses, res)
+
+		hint := &Hint{
+			Destination: dest,
+			Substitute:  substitute,
+			Keys:        keys,
+			Request:     request,
+			Operation:   copts.Operation,
+			Format:      copts.Format,
+			Service:     copts.Service,
+			NValue:      copts.NValue,
+			Created:     time.Now(),
+		}
+		if err := r.sendHint(substitute, hint, copts.Timeout); err != nil {
+			r.logger.WithFields(log.Fields{
+				"destination": dest,
+				"substitute":  substitute,
+				"error":       err,
+			}).Warn("replicator unable to store hint on substitute")
+			continue
+		}
+
+		r.emit(HintStoredEvent{
+			Destination: dest,
+			Substitute:  substitute,
+			Keys:        keys,
+		})
+
+		return res, true
 	}
 
-	return responses, errors
+	return Response{}, false
 }
 
-func (r *Replicator) forwardRequest(dest string, copts *callOptions, fopts *forward.Options) (Response, error) {
+// sendHint stores the hint on the substitute.
+func (r *Replicator) sendHint(substitute string, hint *Hint, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultHintTimeout
+	}
+
+	ctx, cancel := shared.NewTChannelContext(timeout)
+	defer cancel()
+
+	peer := r.channel.Peers().GetOrAdd(substitute)
+	return json.CallPeer(ctx, peer, r.channel.ServiceName(), hintEndpoint, hint, &struct{}{})
+}
+
+func (r *Replicator) hintHandler(ctx json.Context, hint *Hint) (*struct{}, error) {
+	if err := r.hints.Store(*hint); err != nil {
+		r.logger.WithFields(log.Fields{
+			"destination": hint.Destination,
+			"error":       err,
+		}).Warn("replicator unable to store hint")
+		return nil, err
+	}
+	return &struct{}{}, nil
+}
+
+// replayHints sends the hinted writes to the destination and releases the
+// local copies of the writes that were replayed. Hints that fail to replay
+// are stored again.
+func (r *Replicator) replayHints(dest string) {
+	hints, err := r.hints.Take(dest)
+	if err != nil {
+		r.logger.WithFields(log.Fields{
+			"destination": dest,
+			"error":       err,
+		}).Warn("replicator unable to take hints")
+		return
+	}
+
+	for _, hint := range hints {
+		_, err := r.forwardRequest(context.Background(), dest, &callOptions{
+			Request:    hint.Request,
+			KeysByDest: map[string][]string{dest: hint.Keys},
+			Operation:  hint.Operation,
+			Format:     hint.Format,
+			Service:    hint.Service,
+		}, nil)
+
+		if err != nil {
+			if err := r.hints.Store(hint); err != nil {
+				r.logger.WithFields(log.Fields{
+					"destination": dest,
+					"error":       err,
+				}).Warn("replicator unable to store hint")
+			}
+		} else {
+			r.releaseHandoff(hint)
+		}
+
+		r.emit(HintReplayedEvent{
+			Destination: dest,
+			Keys:        hint.Keys,
+			Err:         err,
+		})
+	}
+}
+
+// releaseHandoff removes the keys of a replayed hint that the local node does
+// not own from the local node.
+func (r *Replicator) releaseHandoff(hint Hint) {
+	release := r.defaults.HandoffRelease
+	if release == nil {
+		return
+	}
+
+	local, err := r.sender.WhoAmI()
+	if err != nil {
+		return
+	}
+
+	var keys []string
+	for _, key := range hint.Keys {
+		owners, err := r.sender.LookupN(key, hint.NValue)
+		if err == nil && !containsString(owners, local) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	request, operation, err := release(keys)
+	if err == nil {
+		_, err = r.forwardRequest(context.Background(), local, &callOptions{
+			Request:    request,
+			KeysByDest: map[string][]string{local: keys},
+			Operation:  operation,
+			Format:     hint.Format,
+			Service:    hint.Service,
+		}, nil)
+	}
+
+	if err != nil {
+		r.logger.WithFields(log.Fields{
+			"destination": hint.Destination,
+			"keys":        keys,
+			"error":       err,
+		}).Warn("replicator unable to release handed off write")
+	}
+}
+
+func (r *Replicator) forwardRequest(ctx context.Context, dest string, copts *callOptions,
+	fopts *forward.Options) (Response, error) {
+
 	var response Response
 	var keys = copts.KeysByDest[dest]
 
-	res, err := r.forwarder.ForwardRequest(copts.Request, dest, r.channel.ServiceName(),
+	service := copts.Service
+	if service == "" {
+		service = r.channel.ServiceName()
+	}
+
+	if copts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, copts.Timeout)
+		defer cancel()
+	}
+
+	request, err := copts.request(dest)
+	if err != nil {
+		return response, err
+	}
+
+	res, err := r.forwarder.ForwardRequestContext(ctx, request, dest, service,
 		copts.Operation, keys, copts.Format, fopts)
 
 	if err != nil {
@@ -335,3 +1135,13 @@ func (r *Replicator) forwardRequest(dest string, copts *callOptions, fopts *forw
 
 	return response, nil
 }
+
+// A detachedContext carries the values of its parent, such as headers and
+// spans, but is never cancelled and has no deadline.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
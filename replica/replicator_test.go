@@ -22,12 +22,19 @@ package replica
 
 import (
 	json2 "encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/events/test/mocks"
 	"github.com/uber/ringpop-go/forward"
 	"github.com/uber/ringpop-go/shared"
+	"github.com/uber/ringpop-go/swim"
 	"github.com/uber/tchannel-go"
 	"github.com/uber/tchannel-go/json"
 	"golang.org/x/net/context"
@@ -56,6 +63,28 @@ func (d dummySender) LookupN(key string, n int) ([]string, error) {
 	return d.lookupN, nil
 }
 
+// ringSender is a Sender that returns the first n servers of its ring.
+type ringSender struct {
+	dummySender
+}
+
+func (r ringSender) LookupN(key string, n int) ([]string, error) {
+	if n > len(r.lookupN) {
+		n = len(r.lookupN)
+	}
+	return r.lookupN[:n], nil
+}
+
+// keyedSender is a Sender with a preference list for every key.
+type keyedSender struct {
+	dummySender
+	lookupKeys map[string][]string
+}
+
+func (k keyedSender) LookupN(key string, n int) ([]string, error) {
+	return k.lookupKeys[key], nil
+}
+
 type ReplicatorTestSuite struct {
 	suite.Suite
 	sender     *dummySender
@@ -120,6 +149,13 @@ func (s *ReplicatorTestSuite) RegisterHandler(ch shared.SubChannel, address stri
 			s.Equal(ping.From, "127.0.0.1:3001")
 			return &Pong{"Hello, world!", address}, nil
 		},
+		// only the first peer responds quickly
+		"/slow": func(ctx json.Context, ping *Ping) (*Pong, error) {
+			if address != "127.0.0.1:3002" {
+				time.Sleep(300 * time.Millisecond)
+			}
+			return &Pong{"Hello, world!", address}, nil
+		},
 	}
 
 	s.Require().NoError(json.Register(ch, handler, func(ctx context.Context, err error) {
@@ -127,6 +163,13 @@ func (s *ReplicatorTestSuite) RegisterHandler(ch shared.SubChannel, address stri
 	}))
 }
 
+// ServeHints serves the hints handed off to the peer from a new hint store.
+func (s *ReplicatorTestSuite) ServeHints(address string) *MemoryHintStore {
+	store := NewMemoryHintStore(0)
+	NewReplicator(s.sender, s.peers[address], nil, nil).SetHintStore(store)
+	return store
+}
+
 func (s *ReplicatorTestSuite) TearDownSuite() {
 	s.channel.Close()
 	for _, peer := range s.peers {
@@ -291,6 +334,813 @@ func (s *ReplicatorTestSuite) TestNotEnoughDests() {
 	s.EqualError(err, "rw value not satisfied by destination")
 }
 
+func (s *ReplicatorTestSuite) TestReadContextCancelled() {
+	s.ResetLookupN()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	_, err := s.replicator.ReadContext(ctx, []string{"key"}, ping.Bytes(), "/ping", foptsTimeout, nil)
+	s.EqualError(err, "rw value not satisfied")
+
+	_, err = s.replicator.WriteContext(ctx, []string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		FanoutMode: SerialSequential,
+	})
+	s.EqualError(err, "rw value not satisfied")
+}
+
+func (s *ReplicatorTestSuite) TestEarlyReturnParallel() {
+	s.ResetLookupN()
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	start := time.Now()
+	responses, err := s.replicator.Read([]string{"key"}, ping.Bytes(), "/slow", foptsTimeout, &Options{
+		RValue:      1,
+		EarlyReturn: Enabled,
+	})
+	s.NoError(err, "calls should be replicated")
+	s.Len(responses, 1, "expected only the response that satisfied the r value")
+	s.Equal("127.0.0.1:3002", responses[0].Destination)
+	s.True(time.Since(start) < 250*time.Millisecond, "expected the read to return before the slow peers responded")
+}
+
+func (s *ReplicatorTestSuite) TestEarlyReturnSerial() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	responses, err := s.replicator.Read([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		RValue:      2,
+		FanoutMode:  SerialSequential,
+		EarlyReturn: Enabled,
+	})
+	s.NoError(err, "calls should be replicated")
+	s.Len(responses, 2, "expected no requests after the r value was satisfied")
+	s.Equal("127.0.0.1:3002", responses[0].Destination)
+	s.Equal("127.0.0.1:3003", responses[1].Destination)
+}
+
+func (s *ReplicatorTestSuite) TestOptionsDisableDefault() {
+	s.ResetLookupN()
+
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, &Options{
+		EarlyReturn: Enabled,
+		Stragglers:  DetachStragglers,
+	})
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	responses, err := replicator.Read([]string{"key"}, ping.Bytes(), "/slow", foptsTimeout, &Options{
+		RValue: 1,
+	})
+	s.NoError(err, "calls should be replicated")
+	s.Len(responses, 1, "expected the early return of the replicator")
+
+	responses, err = replicator.Read([]string{"key"}, ping.Bytes(), "/slow", foptsTimeout, &Options{
+		RValue:      1,
+		EarlyReturn: Disabled,
+	})
+	s.NoError(err, "calls should be replicated")
+	s.Len(responses, 3, "expected the request to disable early return")
+
+	opts := mergeDefaultOptions(&Options{
+		HintedHandoff: Disabled,
+		AsyncBackups:  Disabled,
+		ReadPrimary:   Disabled,
+		Stragglers:    CancelStragglers,
+	}, &Options{
+		HintedHandoff: Enabled,
+		AsyncBackups:  Enabled,
+		ReadPrimary:   Enabled,
+		Stragglers:    DetachStragglers,
+	})
+	s.Equal(Disabled, opts.HintedHandoff)
+	s.Equal(Disabled, opts.AsyncBackups)
+	s.Equal(Disabled, opts.ReadPrimary)
+	s.Equal(CancelStragglers, opts.Stragglers)
+}
+
+func (s *ReplicatorTestSuite) TestDetachStragglers() {
+	s.ResetLookupN()
+
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	completed := make(chan StragglerCompletedEvent, 2)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.StragglerCompletedEvent")).Return().Run(func(args mock.Arguments) {
+		completed <- args.Get(0).(StragglerCompletedEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	responses, err := replicator.Write([]string{"key"}, ping.Bytes(), "/slow", foptsTimeout, &Options{
+		WValue:      1,
+		EarlyReturn: Enabled,
+		Stragglers:  DetachStragglers,
+	})
+	s.NoError(err, "calls should be replicated")
+	s.Len(responses, 1)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-completed:
+			s.NoError(event.Err, "expected the straggler to complete")
+			s.Equal("/slow", event.Operation)
+			s.Equal([]string{"key"}, event.Keys)
+			s.NotEqual("127.0.0.1:3002", event.Destination)
+		case <-time.After(time.Second):
+			s.Fail("expected the stragglers to complete in the background")
+		}
+	}
+}
+
+func (s *ReplicatorTestSuite) TestReadResolvedWithRepair() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}
+
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	repaired := make(chan ReadRepairEvent, 2)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.ReadRepairEvent")).Return().Run(func(args mock.Arguments) {
+		repaired <- args.Get(0).(ReadRepairEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	// every peer responds with its own address, the first peer wins
+	pick := ResolverFunc(func(responses []Response) ([]byte, error) {
+		for _, response := range responses {
+			if response.Destination == "127.0.0.1:3002" {
+				return response.Body, nil
+			}
+		}
+		return nil, ErrNoValue
+	})
+
+	value, err := replicator.ReadResolved([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		RValue:   3,
+		Resolver: pick,
+		ReadRepair: func(keys []string, value []byte) ([]byte, string, error) {
+			return ping.Bytes(), "/ping", nil
+		},
+	})
+	s.NoError(err, "calls should be replicated")
+
+	var pong Pong
+	s.Require().NoError(json2.Unmarshal(value, &pong))
+	s.Equal("127.0.0.1:3002", pong.From)
+
+	var dests []string
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-repaired:
+			s.NoError(event.Err, "expected the repair to succeed")
+			s.Equal([]string{"key"}, event.Keys)
+			dests = append(dests, event.Destination)
+		case <-time.After(time.Second):
+			s.Fail("expected the stale replicas to be repaired")
+		}
+	}
+	s.Contains(dests, "127.0.0.1:3003")
+	s.Contains(dests, "127.0.0.1:3004")
+}
+
+func (s *ReplicatorTestSuite) TestReadResolvedMultipleKeys() {
+	var ping = Ping{From: "127.0.0.1:3001"}
+	opts := &Options{
+		NValue: 3,
+		RValue: 2,
+		ReadRepair: func(keys []string, value []byte) ([]byte, string, error) {
+			return ping.Bytes(), "/ping", nil
+		},
+	}
+
+	// the replicas of a and b differ, so their values cannot be reconciled
+	sender := keyedSender{lookupKeys: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003"},
+		"b": {"127.0.0.1:3003", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	repaired := make(chan ReadRepairEvent, 3)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.ReadRepairEvent")).Return().Run(func(args mock.Arguments) {
+		repaired <- args.Get(0).(ReadRepairEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	_, err := replicator.ReadResolved([]string{"a", "b"}, ping.Bytes(), "/ping", foptsTimeout, opts)
+	s.Equal(ErrKeysDiffer, err)
+
+	select {
+	case event := <-repaired:
+		s.Fail("expected no repair of replicas of different keys", "repaired %v", event.Destination)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// every replica holds both keys, so they are repaired together
+	sender = keyedSender{lookupKeys: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"},
+		"b": {"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"},
+	}}
+	replicator = NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+	replicator.RegisterListener(l)
+
+	opts.RValue = 3
+	_, err = replicator.ReadResolved([]string{"a", "b"}, ping.Bytes(), "/ping", foptsTimeout, opts)
+	s.NoError(err, "calls should be replicated")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-repaired:
+			s.NoError(event.Err, "expected the repair to succeed")
+			s.Equal([]string{"a", "b"}, event.Keys)
+		case <-time.After(time.Second):
+			s.Fail("expected the stale replicas to be repaired")
+		}
+	}
+}
+
+func (s *ReplicatorTestSuite) TestHintedHandoff() {
+	sender := ringSender{dummySender{
+		local:   "127.0.0.1:3001",
+		lookupN: []string{"127.0.0.1:3002", "127.0.0.1:3012", "127.0.0.1:3003", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+	local := NewMemoryHintStore(0)
+	replicator.SetHintStore(local)
+	store := s.ServeHints("127.0.0.1:3004")
+
+	stored := make(chan HintStoredEvent, 1)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.HintStoredEvent")).Return().Run(func(args mock.Arguments) {
+		stored <- args.Get(0).(HintStoredEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	responses, err := replicator.Write([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		NValue:        3,
+		WValue:        3,
+		HintedHandoff: Enabled,
+	})
+	s.NoError(err, "expected the write to be handed off")
+	s.Len(responses, 3)
+
+	select {
+	case event := <-stored:
+		s.Equal(HintStoredEvent{
+			Destination: "127.0.0.1:3012",
+			Substitute:  "127.0.0.1:3004",
+			Keys:        []string{"key"},
+		}, event)
+	case <-time.After(time.Second):
+		s.Fail("expected a hint to be stored")
+	}
+
+	hints, err := store.Take("127.0.0.1:3012")
+	s.NoError(err)
+	s.Require().Len(hints, 1, "expected the substitute to keep the hint")
+	s.Equal(ping.Bytes(), hints[0].Request)
+	s.Equal("/ping", hints[0].Operation)
+	s.Equal(3, hints[0].NValue)
+
+	hints, err = local.Take("127.0.0.1:3012")
+	s.NoError(err)
+	s.Empty(hints, "expected the coordinator to keep no hint")
+}
+
+func (s *ReplicatorTestSuite) TestHintedHandoffCancelled() {
+	sender := ringSender{dummySender{
+		local:   "127.0.0.1:3001",
+		lookupN: []string{"127.0.0.1:3002", "127.0.0.1:3012", "127.0.0.1:3003", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+	store := s.ServeHints("127.0.0.1:3004")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	_, err := replicator.WriteContext(ctx, []string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		NValue:        3,
+		WValue:        3,
+		HintedHandoff: Enabled,
+	})
+	s.Error(err)
+
+	hints, err := store.Take("127.0.0.1:3012")
+	s.NoError(err)
+	s.Empty(hints, "expected writes the caller gave up on not to be handed off")
+}
+
+func (s *ReplicatorTestSuite) TestHintedHandoffDistinctSubstitutes() {
+	sender := ringSender{dummySender{
+		local:   "127.0.0.1:3001",
+		lookupN: []string{"127.0.0.1:3002", "127.0.0.1:3012", "127.0.0.1:3013", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+	s.ServeHints("127.0.0.1:3004")
+
+	stored := make(chan HintStoredEvent, 2)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.HintStoredEvent")).Return().Run(func(args mock.Arguments) {
+		stored <- args.Get(0).(HintStoredEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	// both unreachable owners compete for the only substitute, which may
+	// acknowledge the write for one of them
+	result, err := replicator.WriteResult(context.Background(), []string{"key"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{
+			NValue:        3,
+			WValue:        3,
+			FanoutMode:    Parallel,
+			HintedHandoff: Enabled,
+		})
+	s.EqualError(err, "rw value not satisfied")
+	s.Equal(2, result.count(Succeeded))
+
+	select {
+	case event := <-stored:
+		s.Equal("127.0.0.1:3004", event.Substitute)
+	case <-time.After(time.Second):
+		s.Fail("expected a hint to be stored")
+	}
+
+	select {
+	case event := <-stored:
+		s.Fail("expected a single hint", "stored a hint for %v", event.Destination)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *ReplicatorTestSuite) TestHintedHandoffSkipsUnhealthy() {
+	sender := ringSender{dummySender{
+		local:   "127.0.0.1:3001",
+		lookupN: []string{"127.0.0.1:3002", "127.0.0.1:3012", "127.0.0.1:3003", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+	replicator.health.update([]swim.Change{{Address: "127.0.0.1:3003", Status: swim.Suspect}})
+	s.ServeHints("127.0.0.1:3004")
+
+	stored := make(chan HintStoredEvent, 1)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.HintStoredEvent")).Return().Run(func(args mock.Arguments) {
+		stored <- args.Get(0).(HintStoredEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	_, err := replicator.Write([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		NValue:        2,
+		WValue:        2,
+		HintedHandoff: Enabled,
+	})
+	s.NoError(err, "expected the write to be handed off")
+
+	select {
+	case event := <-stored:
+		s.Equal("127.0.0.1:3004", event.Substitute, "expected the suspect node to be passed over")
+	case <-time.After(time.Second):
+		s.Fail("expected a hint to be stored")
+	}
+}
+
+func (s *ReplicatorTestSuite) TestReplayHints() {
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, nil)
+	store := NewMemoryHintStore(0)
+	replicator.SetHintStore(store)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+	s.NoError(store.Store(Hint{
+		Destination: "127.0.0.1:3003",
+		Keys:        []string{"key"},
+		Request:     ping.Bytes(),
+		Operation:   "/ping",
+	}))
+
+	replayed := make(chan HintReplayedEvent, 1)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.HintReplayedEvent")).Return().Run(func(args mock.Arguments) {
+		replayed <- args.Get(0).(HintReplayedEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	replicator.HandleEvent(swim.MemberlistChangesAppliedEvent{
+		Changes: []swim.Change{{Address: "127.0.0.1:3003", Status: swim.Alive}},
+	})
+
+	select {
+	case event := <-replayed:
+		s.NoError(event.Err, "expected the hint to be replayed")
+		s.Equal("127.0.0.1:3003", event.Destination)
+	case <-time.After(time.Second):
+		s.Fail("expected the hint to be replayed")
+	}
+
+	hints, err := store.Take("127.0.0.1:3003")
+	s.NoError(err)
+	s.Empty(hints, "expected the replayed hint to be removed")
+}
+
+func (s *ReplicatorTestSuite) TestReplayHintsPeriodic() {
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, nil)
+	store := NewMemoryHintStore(0)
+	replicator.SetHintStore(store)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+	s.NoError(store.Store(Hint{
+		Destination: "127.0.0.1:3003",
+		Keys:        []string{"key"},
+		Request:     ping.Bytes(),
+		Operation:   "/ping",
+	}))
+
+	replayed := make(chan HintReplayedEvent, 1)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.HintReplayedEvent")).Return().Run(func(args mock.Arguments) {
+		replayed <- args.Get(0).(HintReplayedEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	replicator.StartHintReplay(10 * time.Millisecond)
+	replicator.StartHintReplay(10 * time.Millisecond)
+	defer replicator.StopHintReplay()
+
+	select {
+	case event := <-replayed:
+		s.NoError(event.Err, "expected the hint to be replayed")
+		s.Equal("127.0.0.1:3003", event.Destination)
+	case <-time.After(time.Second):
+		s.Fail("expected the hint to be replayed without a membership change")
+	}
+
+	replicator.StopHintReplay()
+	replicator.StopHintReplay()
+}
+
+func (s *ReplicatorTestSuite) TestReplayHintsRelease() {
+	released := make(chan []string, 2)
+	sender := keyedSender{
+		dummySender: dummySender{local: "127.0.0.1:3002"},
+		lookupKeys: map[string][]string{
+			"handed": {"127.0.0.1:3003", "127.0.0.1:3004"},
+			"owned":  {"127.0.0.1:3002", "127.0.0.1:3003"},
+		},
+	}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, &Options{
+		HandoffRelease: func(keys []string) ([]byte, string, error) {
+			released <- keys
+			return Ping{From: "127.0.0.1:3001"}.Bytes(), "/ping", nil
+		},
+	})
+	store := NewMemoryHintStore(0)
+	replicator.SetHintStore(store)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+	s.NoError(store.Store(Hint{
+		Destination: "127.0.0.1:3003",
+		Keys:        []string{"handed", "owned"},
+		Request:     ping.Bytes(),
+		Operation:   "/ping",
+		NValue:      2,
+	}))
+
+	replicator.replayHints("127.0.0.1:3003")
+
+	select {
+	case keys := <-released:
+		s.Equal([]string{"handed"}, keys, "expected the keys the substitute owns to be kept")
+	case <-time.After(time.Second):
+		s.Fail("expected the handed off write to be released")
+	}
+}
+
+func (s *ReplicatorTestSuite) TestReadJSON() {
+	s.ResetLookupN()
+
+	responses, err := s.replicator.ReadJSON(context.Background(), []string{"key"}, Ping{From: "127.0.0.1:3001"},
+		"/ping", foptsTimeout, &Options{Service: "ping"})
+	s.NoError(err, "calls should be replicated")
+	s.Len(responses, 3, "expected response from each peer")
+	for _, response := range responses {
+		var pong Pong
+		s.Require().NoError(response.DecodeJSON(&pong))
+		s.Equal(response.Destination, pong.From)
+	}
+}
+
+func (s *ReplicatorTestSuite) TestTimeout() {
+	s.ResetLookupN()
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	responses, err := s.replicator.Read([]string{"key"}, ping.Bytes(), "/slow", foptsTimeout, &Options{
+		RValue:  3,
+		Timeout: 100 * time.Millisecond,
+	})
+	s.EqualError(err, "rw value not satisfied")
+	s.Len(responses, 1, "expected only the fast peer to respond in time")
+}
+
+func (s *ReplicatorTestSuite) TestReadResult() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3012", "127.0.0.1:3003"}
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	result, err := s.replicator.ReadResult(context.Background(), []string{"key"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{RValue: 3, NValue: 3, FanoutMode: SerialSequential})
+	s.Require().IsType(&QuorumError{}, err)
+	s.EqualError(err, "rw value not satisfied")
+	s.Equal(result, err.(*QuorumError).Result)
+
+	s.Require().Len(result.Replicas, 3)
+	s.Equal("127.0.0.1:3002", result.Replicas[0].Destination)
+	s.Equal(Succeeded, result.Replicas[0].Outcome)
+	s.Equal([]string{"key"}, result.Replicas[0].Keys)
+	s.NotNil(result.Replicas[0].Response)
+	s.True(result.Replicas[0].Latency > 0)
+
+	s.Equal("127.0.0.1:3012", result.Replicas[1].Destination)
+	s.Equal(Failed, result.Replicas[1].Outcome)
+	s.Error(result.Replicas[1].Err)
+	s.Nil(result.Replicas[1].Response)
+
+	s.Equal(Succeeded, result.Replicas[2].Outcome)
+	s.Len(result.Responses(), 2)
+	s.Len(result.Errors(), 1)
+}
+
+func (s *ReplicatorTestSuite) TestWriteResultSkipped() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	result, err := s.replicator.WriteResult(context.Background(), []string{"key"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{WValue: 1, FanoutMode: SerialSequential, EarlyReturn: Enabled})
+	s.NoError(err)
+	s.Require().Len(result.Replicas, 3)
+	s.Equal(Succeeded, result.Replicas[0].Outcome)
+	s.Equal(Skipped, result.Replicas[1].Outcome)
+	s.Equal(Skipped, result.Replicas[2].Outcome)
+	s.NoError(result.Replicas[2].Err)
+}
+
+func (s *ReplicatorTestSuite) TestWritePerKeyQuorum() {
+	sender := keyedSender{lookupKeys: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3012"},
+		"b": {"127.0.0.1:3012", "127.0.0.1:3013", "127.0.0.1:3002"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	// three of the four destinations acknowledge, but only one replica of b
+	result, err := replicator.WriteResult(context.Background(), []string{"a", "b"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{WValue: 2})
+	s.EqualError(err, "rw value not satisfied")
+	s.Equal([]string{"a"}, result.KeysMet)
+	s.Equal([]string{"b"}, result.KeysMissed)
+
+	result, err = replicator.WriteResult(context.Background(), []string{"a", "b"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{WValue: 1})
+	s.NoError(err)
+	s.Equal([]string{"a", "b"}, result.KeysMet)
+	s.Empty(result.KeysMissed)
+}
+
+func (s *ReplicatorTestSuite) TestWriteRequestBuilder() {
+	sender := keyedSender{lookupKeys: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003"},
+		"b": {"127.0.0.1:3003", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	var lock sync.Mutex
+	built := make(map[string][]string)
+	builder := func(dest string, keys []string) ([]byte, error) {
+		lock.Lock()
+		built[dest] = keys
+		lock.Unlock()
+		return Ping{From: "127.0.0.1:3001"}.Bytes(), nil
+	}
+
+	result, err := replicator.WriteResult(context.Background(), []string{"a", "b"}, nil, "/ping",
+		foptsTimeout, &Options{NValue: 2, WValue: 2, RequestBuilder: builder})
+	s.NoError(err)
+	s.Len(result.Replicas, 3)
+	s.Equal(map[string][]string{
+		"127.0.0.1:3002": {"a"},
+		"127.0.0.1:3003": {"a", "b"},
+		"127.0.0.1:3004": {"b"},
+	}, built)
+
+	builder = func(dest string, keys []string) ([]byte, error) {
+		return nil, errors.New("unable to build request")
+	}
+	result, err = replicator.WriteResult(context.Background(), []string{"a", "b"}, nil, "/ping",
+		foptsTimeout, &Options{NValue: 2, WValue: 2, RequestBuilder: builder})
+	s.EqualError(err, "rw value not satisfied")
+	s.Len(result.Errors(), 3)
+}
+
+func (s *ReplicatorTestSuite) TestPrimaryBackupWrite() {
+	sender := keyedSender{lookupKeys: map[string][]string{
+		"key": {"127.0.0.1:3012", "127.0.0.1:3002", "127.0.0.1:3003"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+	opts := &Options{WValue: 2, FanoutMode: PrimaryBackup}
+
+	// the primary is unreachable, so the backups never see the write
+	result, err := replicator.WriteResult(context.Background(), []string{"key"}, ping.Bytes(), "/ping",
+		foptsTimeout, opts)
+	s.EqualError(err, "rw value not satisfied")
+	s.Require().Len(result.Replicas, 3)
+	s.Equal("127.0.0.1:3012", result.Replicas[0].Destination)
+	s.NotEqual(Succeeded, result.Replicas[0].Outcome)
+	s.Equal(Skipped, result.Replicas[1].Outcome)
+	s.Equal(ErrPrimaryFailed, result.Replicas[1].Err)
+	s.Equal(Skipped, result.Replicas[2].Outcome)
+
+	// fail over to the next replica once SWIM reports the primary faulty
+	replicator.HandleEvent(swim.MemberlistChangesAppliedEvent{Changes: []swim.Change{
+		{Address: "127.0.0.1:3012", Status: swim.Faulty},
+	}})
+
+	result, err = replicator.WriteResult(context.Background(), []string{"key"}, ping.Bytes(), "/ping",
+		foptsTimeout, opts)
+	s.NoError(err)
+	s.Require().Len(result.Replicas, 3)
+	s.Equal("127.0.0.1:3002", result.Replicas[0].Destination)
+	s.Equal(Succeeded, result.Replicas[0].Outcome)
+	s.Len(result.Responses(), 2)
+}
+
+func (s *ReplicatorTestSuite) TestPrimaryBackupMultipleKeys() {
+	sender := keyedSender{lookupKeys: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003"},
+		"b": {"127.0.0.1:3003", "127.0.0.1:3002"},
+		"c": {"127.0.0.1:3002", "127.0.0.1:3004"},
+	}}
+	replicator := NewReplicator(sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+	opts := &Options{NValue: 2, WValue: 2, FanoutMode: PrimaryBackup}
+
+	// the primary of a is a backup of b
+	_, err := replicator.WriteResult(context.Background(), []string{"a", "b"}, ping.Bytes(), "/ping",
+		foptsTimeout, opts)
+	s.Equal(ErrPrimariesDiffer, err)
+
+	result, err := replicator.WriteResult(context.Background(), []string{"a", "c"}, ping.Bytes(), "/ping",
+		foptsTimeout, opts)
+	s.NoError(err, "expected keys of the same primary to be written")
+	s.Require().Len(result.Replicas, 3)
+	s.Equal("127.0.0.1:3002", result.Replicas[0].Destination)
+
+	// reads are not affected
+	_, err = replicator.ReadResult(context.Background(), []string{"a", "b"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{NValue: 2, RValue: 1, FanoutMode: PrimaryBackup, ReadPrimary: Enabled})
+	s.NoError(err)
+}
+
+func (s *ReplicatorTestSuite) TestPrimaryBackupAsync() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}
+
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	completed := make(chan BackupCompletedEvent, 2)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("replica.BackupCompletedEvent")).Return().Run(func(args mock.Arguments) {
+		completed <- args.Get(0).(BackupCompletedEvent)
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	result, err := replicator.WriteResult(context.Background(), []string{"key"}, ping.Bytes(), "/ping",
+		foptsTimeout, &Options{WValue: 3, FanoutMode: PrimaryBackup, AsyncBackups: Enabled})
+	s.NoError(err, "expected the primary to acknowledge the write")
+	s.Require().Len(result.Replicas, 3)
+	s.Equal(Succeeded, result.Replicas[0].Outcome)
+	s.Equal(Skipped, result.Replicas[1].Outcome)
+	s.Equal(Skipped, result.Replicas[2].Outcome)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-completed:
+			s.NoError(event.Err, "expected the backup to complete")
+			s.Equal("/ping", event.Operation)
+			s.NotEqual("127.0.0.1:3002", event.Destination)
+		case <-time.After(time.Second):
+			s.Fail("expected the backups to complete in the background")
+		}
+	}
+}
+
+func (s *ReplicatorTestSuite) TestPrimaryBackupReadPrimary() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"}
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	responses, err := s.replicator.Read([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		RValue:      2,
+		FanoutMode:  PrimaryBackup,
+		ReadPrimary: Enabled,
+	})
+	s.NoError(err)
+	s.Require().Len(responses, 1)
+	s.Equal("127.0.0.1:3002", responses[0].Destination)
+
+	responses, err = s.replicator.Read([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{
+		RValue:     2,
+		FanoutMode: PrimaryBackup,
+	})
+	s.NoError(err)
+	s.Len(responses, 3)
+}
+
+func (s *ReplicatorTestSuite) TestRequestEvents() {
+	s.sender.lookupN = []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3012"}
+
+	replicator := NewReplicator(s.sender, s.channel.GetSubChannel("ping"), nil, nil)
+
+	emitted := make(chan events.Event, 10)
+	l := &mocks.EventListener{}
+	l.On("HandleEvent", mock.Anything).Return().Run(func(args mock.Arguments) {
+		emitted <- args.Get(0).(events.Event)
+	})
+	replicator.RegisterListener(l)
+
+	var ping = Ping{From: "127.0.0.1:3001"}
+
+	_, err := replicator.Write([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{WValue: 3})
+	s.Error(err)
+
+	seen := make(map[string]events.Event)
+	for len(seen) < 4 {
+		select {
+		case event := <-emitted:
+			seen[fmt.Sprintf("%T", event)] = event
+		case <-time.After(time.Second):
+			s.Fail("expected the events of the request", "got %v", seen)
+			return
+		}
+	}
+
+	s.Equal(RequestStartedEvent{Method: "write", Operation: "/ping", Keys: []string{"key"}},
+		seen["replica.RequestStartedEvent"])
+
+	latency := seen["replica.FanoutLatencyEvent"].(FanoutLatencyEvent)
+	s.Equal(3, latency.Destinations)
+
+	destErr := seen["replica.DestinationErrorEvent"].(DestinationErrorEvent)
+	s.Equal("127.0.0.1:3012", destErr.Destination)
+	s.Error(destErr.Err)
+
+	failed := seen["replica.QuorumFailedEvent"].(QuorumFailedEvent)
+	s.Equal([]string{"key"}, failed.KeysMissed)
+	s.Equal(3, failed.RWValue)
+
+	_, err = replicator.Write([]string{"key"}, ping.Bytes(), "/ping", foptsTimeout, &Options{WValue: 2})
+	s.NoError(err)
+
+	for {
+		select {
+		case event := <-emitted:
+			if met, ok := event.(QuorumMetEvent); ok {
+				s.Equal(2, met.RWValue)
+				return
+			}
+		case <-time.After(time.Second):
+			s.Fail("expected the quorum to be met")
+			return
+		}
+	}
+}
+
 func TestReplicatorTestSuite(t *testing.T) {
 	suite.Run(t, new(ReplicatorTestSuite))
 }
@@ -0,0 +1,116 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoValue is returned by a Resolver when none of the responses holds a
+// value.
+var ErrNoValue = errors.New("no replica responded with a value")
+
+// ErrKeysDiffer is returned by ReadResolved when the replicas that responded
+// do not all hold the same keys, so their responses cannot be reconciled into
+// a single value.
+var ErrKeysDiffer = errors.New("replicas responded for different keys")
+
+// A Resolver reconciles the responses of the replicas of a read into a single
+// value. It may pick the value of one of the responses or merge them.
+type Resolver interface {
+	Resolve(responses []Response) ([]byte, error)
+}
+
+// ResolverFunc is an adapter to use an ordinary function as a Resolver.
+type ResolverFunc func(responses []Response) ([]byte, error)
+
+// Resolve calls f(responses).
+func (f ResolverFunc) Resolve(responses []Response) ([]byte, error) {
+	return f(responses)
+}
+
+// FirstNonEmpty is a Resolver that picks the first response with a non-empty
+// body. Responses of parallel reads are ordered by the time they arrived,
+// responses of serial reads by the order in which they were sent.
+var FirstNonEmpty = ResolverFunc(func(responses []Response) ([]byte, error) {
+	for _, response := range responses {
+		if len(response.Body) > 0 {
+			return response.Body, nil
+		}
+	}
+	return nil, ErrNoValue
+})
+
+// A VersionFunc returns the version of the value in the body of a response.
+type VersionFunc func(body []byte) (int64, error)
+
+// LastWriteWins returns a Resolver that picks the response with the highest
+// version. Empty responses are ignored; when versions tie the first response
+// wins.
+func LastWriteWins(version VersionFunc) Resolver {
+	return ResolverFunc(func(responses []Response) ([]byte, error) {
+		var winner []byte
+		var highest int64
+
+		for _, response := range responses {
+			if len(response.Body) == 0 {
+				continue
+			}
+
+			v, err := version(response.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			if winner == nil || v > highest {
+				winner = response.Body
+				highest = v
+			}
+		}
+
+		if winner == nil {
+			return nil, ErrNoValue
+		}
+		return winner, nil
+	})
+}
+
+// JSONVersion returns a VersionFunc that reads the version from a numeric
+// field of a JSON object.
+func JSONVersion(field string) VersionFunc {
+	return func(body []byte) (int64, error) {
+		var fields map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return 0, err
+		}
+
+		number, ok := fields[field].(json.Number)
+		if !ok {
+			return 0, fmt.Errorf("version field %q is missing or not a number", field)
+		}
+		return number.Int64()
+	}
+}
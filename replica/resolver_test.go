@@ -0,0 +1,59 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstNonEmpty(t *testing.T) {
+	value, err := FirstNonEmpty.Resolve([]Response{
+		{Destination: "127.0.0.1:3002"},
+		{Destination: "127.0.0.1:3003", Body: []byte("b")},
+		{Destination: "127.0.0.1:3004", Body: []byte("c")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), value)
+
+	_, err = FirstNonEmpty.Resolve([]Response{{Destination: "127.0.0.1:3002"}})
+	assert.Equal(t, ErrNoValue, err)
+}
+
+func TestLastWriteWins(t *testing.T) {
+	resolver := LastWriteWins(JSONVersion("version"))
+
+	value, err := resolver.Resolve([]Response{
+		{Body: []byte(`{"value":"old","version":1}`)},
+		{Body: []byte(`{"value":"new","version":3}`)},
+		{},
+		{Body: []byte(`{"value":"tie","version":3}`)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"value":"new","version":3}`), value)
+
+	_, err = resolver.Resolve([]Response{{}})
+	assert.Equal(t, ErrNoValue, err)
+
+	_, err = resolver.Resolve([]Response{{Body: []byte(`{"value":"unversioned"}`)}})
+	assert.EqualError(t, err, `version field "version" is missing or not a number`)
+}
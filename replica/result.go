@@ -0,0 +1,240 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"time"
+
+	"github.com/uber/ringpop-go/forward"
+	"golang.org/x/net/context"
+)
+
+// An Outcome is the outcome of a replicated call to a single destination.
+type Outcome int
+
+const (
+	// Succeeded means the destination responded without an error.
+	Succeeded Outcome = iota
+
+	// Failed means the call to the destination failed.
+	Failed
+
+	// TimedOut means the destination did not respond in time.
+	TimedOut
+
+	// Skipped means the call was not sent, or was left behind before it
+	// completed, because the outcome of the request was already known or
+	// the caller gave up.
+	Skipped
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Succeeded:
+		return "succeeded"
+	case Failed:
+		return "failed"
+	case TimedOut:
+		return "timed out"
+	case Skipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// A ReplicaResult is the outcome of the replicated call to a destination.
+// Substitute is the node that accepted a write that was handed off, Response
+// is only set when the call succeeded.
+type ReplicaResult struct {
+	Destination string
+	Substitute  string
+	Keys        []string
+	Outcome     Outcome
+	Err         error
+	Latency     time.Duration
+	Response    *Response
+}
+
+// A Result lists the outcome of a replicated request for every destination
+// it was meant for. A request succeeds when every key was acknowledged by R or
+// W of the replicas in its own preference list; KeysMet and KeysMissed list
+// the keys that did and did not meet that quorum.
+type Result struct {
+	RWValue  int
+	Replicas []ReplicaResult
+
+	KeysMet    []string
+	KeysMissed []string
+
+	destsByKey map[string][]string
+}
+
+// Responses returns the responses of the destinations that succeeded.
+func (r *Result) Responses() []Response {
+	var responses []Response
+	for _, replica := range r.Replicas {
+		if replica.Outcome == Succeeded {
+			responses = append(responses, *replica.Response)
+		}
+	}
+	return responses
+}
+
+// responses returns the responses of a result that may be nil.
+func (r *Result) responses() []Response {
+	if r == nil {
+		return nil
+	}
+	return r.Responses()
+}
+
+// Errors returns the errors of the destinations that failed or timed out.
+func (r *Result) Errors() []error {
+	var errs []error
+	for _, replica := range r.Replicas {
+		if replica.Outcome == Failed || replica.Outcome == TimedOut {
+			errs = append(errs, replica.Err)
+		}
+	}
+	return errs
+}
+
+// count returns the number of destinations with the outcome.
+func (r *Result) count(outcome Outcome) int {
+	count := 0
+	for _, replica := range r.Replicas {
+		if replica.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+// acks returns the number of replicas of the key that acknowledged the
+// request and the number of replicas that did not respond yet.
+func (r *Result) acks(key string, done map[string]Outcome) (acks, pending int) {
+	for _, dest := range r.destsByKey[key] {
+		outcome, ok := done[dest]
+		switch {
+		case !ok:
+			pending++
+		case outcome == Succeeded:
+			acks++
+		}
+	}
+	return acks, pending
+}
+
+func (r *Result) outcomes() map[string]Outcome {
+	done := make(map[string]Outcome, len(r.Replicas))
+	for _, replica := range r.Replicas {
+		done[replica.Destination] = replica.Outcome
+	}
+	return done
+}
+
+// decided returns whether the outcome of the request is known before all
+// destinations responded: every key met its quorum, or a key can no longer
+// meet it.
+func (r *Result) decided() bool {
+	done := r.outcomes()
+
+	met := true
+	for key := range r.destsByKey {
+		acks, pending := r.acks(key, done)
+		if acks+pending < r.RWValue {
+			return true
+		}
+		if acks < r.RWValue {
+			met = false
+		}
+	}
+	return met
+}
+
+// quorumByKey divides the keys into the keys that met their quorum and the
+// keys that did not.
+func (r *Result) quorumByKey(keys []string) (met, missed []string) {
+	done := r.outcomes()
+	for _, key := range keys {
+		if acks, _ := r.acks(key, done); acks >= r.RWValue {
+			met = append(met, key)
+		} else {
+			missed = append(missed, key)
+		}
+	}
+	return met, missed
+}
+
+// add records the outcome of the call to a destination.
+func (r *Result) add(dest string, keys []string, res Response, err error, latency time.Duration) {
+	replica := ReplicaResult{
+		Destination: dest,
+		Keys:        keys,
+		Err:         err,
+		Latency:     latency,
+	}
+
+	switch {
+	case err == nil:
+		replica.Outcome = Succeeded
+		replica.Response = &res
+		if res.Destination != dest {
+			replica.Substitute = res.Destination
+		}
+	case isTimeout(err):
+		replica.Outcome = TimedOut
+	default:
+		replica.Outcome = Failed
+	}
+
+	r.Replicas = append(r.Replicas, replica)
+}
+
+// skip records that the call to a destination was not sent or left behind.
+func (r *Result) skip(dest string, keys []string, err error) {
+	r.Replicas = append(r.Replicas, ReplicaResult{
+		Destination: dest,
+		Keys:        keys,
+		Outcome:     Skipped,
+		Err:         err,
+	})
+}
+
+func isTimeout(err error) bool {
+	switch err := err.(type) {
+	case *forward.TimeoutError:
+		return true
+	case *forward.MaxRetriesError:
+		return isTimeout(err.Err)
+	}
+	return err == context.DeadlineExceeded
+}
+
+// A QuorumError is returned when a replicated request did not satisfy its R
+// or W value. The result lists the outcome for every destination.
+type QuorumError struct {
+	Result *Result
+}
+
+func (e *QuorumError) Error() string {
+	return "rw value not satisfied"
+}
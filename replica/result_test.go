@@ -0,0 +1,96 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replica
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/forward"
+	"golang.org/x/net/context"
+)
+
+func TestOutcomeString(t *testing.T) {
+	assert.Equal(t, "succeeded", Succeeded.String())
+	assert.Equal(t, "failed", Failed.String())
+	assert.Equal(t, "timed out", TimedOut.String())
+	assert.Equal(t, "skipped", Skipped.String())
+	assert.Equal(t, "unknown", Outcome(-1).String())
+}
+
+func TestResultAdd(t *testing.T) {
+	result := &Result{RWValue: 2}
+	result.add("127.0.0.1:3002", []string{"key"}, Response{Destination: "127.0.0.1:3002"}, nil, 0)
+	result.add("127.0.0.1:3003", []string{"key"}, Response{Destination: "127.0.0.1:3005"}, nil, 0)
+	result.add("127.0.0.1:3004", []string{"key"}, Response{}, &forward.TimeoutError{}, 0)
+	result.add("127.0.0.1:3006", []string{"key"}, Response{}, &forward.MaxRetriesError{Err: context.DeadlineExceeded}, 0)
+	result.add("127.0.0.1:3007", []string{"key"}, Response{}, errors.New("unreachable"), 0)
+	result.skip("127.0.0.1:3008", []string{"key"}, nil)
+
+	var outcomes []Outcome
+	for _, replica := range result.Replicas {
+		outcomes = append(outcomes, replica.Outcome)
+	}
+	assert.Equal(t, []Outcome{Succeeded, Succeeded, TimedOut, TimedOut, Failed, Skipped}, outcomes)
+	assert.Equal(t, "", result.Replicas[0].Substitute)
+	assert.Equal(t, "127.0.0.1:3005", result.Replicas[1].Substitute, "expected the substitute of a handed off write")
+	assert.Len(t, result.Responses(), 2)
+	assert.Len(t, result.Errors(), 3)
+}
+
+func TestResultDecided(t *testing.T) {
+	result := &Result{RWValue: 2, destsByKey: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"},
+		"b": {"127.0.0.1:3004", "127.0.0.1:3005", "127.0.0.1:3006"},
+	}}
+	assert.False(t, result.decided(), "expected quorum to be pending")
+
+	result.add("127.0.0.1:3002", []string{"a"}, Response{}, nil, 0)
+	result.add("127.0.0.1:3003", []string{"a"}, Response{}, nil, 0)
+	assert.False(t, result.decided(), "expected quorum of b to be pending")
+
+	result.add("127.0.0.1:3004", []string{"a", "b"}, Response{}, errors.New("unreachable"), 0)
+	result.add("127.0.0.1:3005", []string{"b"}, Response{}, nil, 0)
+	assert.False(t, result.decided(), "expected quorum of b to be pending")
+
+	result.add("127.0.0.1:3006", []string{"b"}, Response{}, nil, 0)
+	assert.True(t, result.decided(), "expected quorum to be met")
+
+	met, missed := result.quorumByKey([]string{"a", "b"})
+	assert.Equal(t, []string{"a", "b"}, met)
+	assert.Empty(t, missed)
+}
+
+func TestResultDecidedImpossible(t *testing.T) {
+	result := &Result{RWValue: 2, destsByKey: map[string][]string{
+		"a": {"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3004"},
+		"b": {"127.0.0.1:3004", "127.0.0.1:3005", "127.0.0.1:3006"},
+	}}
+	result.add("127.0.0.1:3004", []string{"a", "b"}, Response{}, nil, 0)
+	result.add("127.0.0.1:3005", []string{"b"}, Response{}, errors.New("unreachable"), 0)
+	result.add("127.0.0.1:3006", []string{"b"}, Response{}, errors.New("unreachable"), 0)
+	assert.True(t, result.decided(), "expected quorum of b to be impossible")
+
+	met, missed := result.quorumByKey([]string{"a", "b"})
+	assert.Empty(t, met)
+	assert.Equal(t, []string{"a", "b"}, missed)
+}
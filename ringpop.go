@@ -38,9 +38,12 @@ import (
 	"github.com/uber/ringpop-go/forward"
 	"github.com/uber/ringpop-go/hashring"
 	"github.com/uber/ringpop-go/logging"
+	"github.com/uber/ringpop-go/replica"
 	"github.com/uber/ringpop-go/shared"
 	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/tracing"
 	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
 )
 
 // Interface specifies the public facing methods a user of ringpop is able to
@@ -62,6 +65,21 @@ type Interface interface {
 	Forward(dest string, keys []string, request []byte, service, endpoint string, format tchannel.Format, opts *forward.Options) ([]byte, error)
 }
 
+// ContextInterface extends Interface with the methods that accept the context
+// of a request, and the other methods that were added since. They are kept
+// off Interface so that existing implementations of it remain valid.
+type ContextInterface interface {
+	Interface
+
+	BootstrapContext(ctx context.Context, opts *swim.BootstrapOptions) ([]string, error)
+	ReplicaRanges(n int) ([]hashring.ReplicaRange, error)
+
+	HandleOrForwardContext(ctx context.Context, key string, request []byte, response *[]byte, service, endpoint string, format tchannel.Format, opts *forward.Options) (bool, error)
+	ForwardContext(ctx context.Context, dest string, keys []string, request []byte, service, endpoint string, format tchannel.Format, opts *forward.Options) ([]byte, error)
+	ForwardAsync(ctx context.Context, dest string, keys []string, request []byte, service, endpoint string, format tchannel.Format, opts *forward.Options) *forward.Future
+	ScatterGather(ctx context.Context, keys []string, build forward.RequestBuilder, handleLocal forward.LocalHandler, service, endpoint string, format tchannel.Format, opts *forward.Options) ([]forward.ScatterResponse, error)
+}
+
 // Ringpop is a consistent hashring that uses a gossip protocol to disseminate
 // changes around the ring.
 type Ringpop struct {
@@ -93,6 +111,9 @@ type Ringpop struct {
 	}
 
 	logger log.Logger
+	tracer tracing.Tracer
+
+	forwarderOptions []forward.ForwarderOption
 
 	tickers   chan *clock.Ticker
 	startTime time.Time
@@ -176,8 +197,13 @@ func (rp *Ringpop) init() error {
 	rp.stats.prefix = fmt.Sprintf("ringpop.%s", rp.stats.hostport)
 	rp.stats.keys = make(map[string]string)
 
-	rp.forwarder = forward.NewForwarder(rp, rp.subChannel)
+	forwarderOptions := append([]forward.ForwarderOption{
+		forward.Tracer(rp.tracer),
+		forward.Clock(rp.clock),
+	}, rp.forwarderOptions...)
+	rp.forwarder = forward.NewForwarder(rp, rp.subChannel, forwarderOptions...)
 	rp.forwarder.RegisterListener(rp)
+	rp.ring.RegisterListener(rp.forwarder)
 
 	rp.startTimers()
 	rp.setState(initialized)
@@ -366,6 +392,44 @@ func (rp *Ringpop) Bootstrap(bootstrapOpts *swim.BootstrapOptions) ([]string, er
 	return joined, nil
 }
 
+// BootstrapContext is like Bootstrap but returns when the context is done. The
+// deadline of the context limits the MaxJoinDuration of the bootstrap options.
+// Note that a join in progress is not interrupted by cancelling the context.
+func (rp *Ringpop) BootstrapContext(ctx context.Context, bootstrapOpts *swim.BootstrapOptions) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var opts swim.BootstrapOptions
+		if bootstrapOpts != nil {
+			opts = *bootstrapOpts
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		if opts.MaxJoinDuration == 0 || opts.MaxJoinDuration > remaining {
+			opts.MaxJoinDuration = remaining
+		}
+		bootstrapOpts = &opts
+	}
+
+	result := make(chan bootstrapResult, 1)
+	go func() {
+		joined, err := rp.Bootstrap(bootstrapOpts)
+		result <- bootstrapResult{joined, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.joined, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // Ready returns whether or not ringpop is bootstrapped and ready to receive
 // requests.
 func (rp *Ringpop) Ready() bool {
@@ -519,11 +583,32 @@ func (rp *Ringpop) HandleEvent(event events.Event) {
 	case forward.InflightRequestsMiscountEvent:
 		rp.statter.IncCounter(rp.getStatKey("requestProxy.miscount."+string(event.Operation)), nil, 1)
 
+	case forward.InflightLimitRejectedEvent:
+		if event.Global {
+			rp.statter.IncCounter(rp.getStatKey("requestProxy.inflight.rejected.global"), nil, 1)
+		} else {
+			rp.statter.IncCounter(rp.getStatKey("requestProxy.inflight.rejected.destination"), nil, 1)
+		}
+
 	case forward.FailedEvent:
-		rp.statter.IncCounter(rp.getStatKey("requestProxy.send.error"), nil, 1)
+		tags := forwardTags(event.Destination, event.Service, event.Endpoint)
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.send.error"), tags, 1)
+		if event.Attempts > 0 {
+			rp.statter.RecordTimer(rp.getStatKey("requestProxy.send.error.latency"), tags, event.Duration)
+			rp.statter.IncCounter(rp.getStatKey("requestProxy.send.attempts"), tags, int64(event.Attempts))
+		}
+
+	case forward.LoopDetectedEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.loop.detected"), nil, 1)
+
+	case forward.ChecksumMismatchEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.checksum.mismatch"), nil, 1)
 
 	case forward.SuccessEvent:
-		rp.statter.IncCounter(rp.getStatKey("requestProxy.send.success"), nil, 1)
+		tags := forwardTags(event.Destination, event.Service, event.Endpoint)
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.send.success"), tags, 1)
+		rp.statter.RecordTimer(rp.getStatKey("requestProxy.send.latency"), tags, event.Duration)
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.send.attempts"), tags, int64(event.Attempts))
 
 	case forward.MaxRetriesEvent:
 		rp.statter.IncCounter(rp.getStatKey("requestProxy.retry.failed"), nil, 1)
@@ -534,6 +619,9 @@ func (rp *Ringpop) HandleEvent(event events.Event) {
 	case forward.RetryAbortEvent:
 		rp.statter.IncCounter(rp.getStatKey("requestProxy.retry.aborted"), nil, 1)
 
+	case forward.RetryBudgetExhaustedEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.retry.budget-exhausted"), nil, 1)
+
 	case forward.RerouteEvent:
 		me, _ := rp.WhoAmI()
 		if event.NewDestination == me {
@@ -542,8 +630,49 @@ func (rp *Ringpop) HandleEvent(event events.Event) {
 			rp.statter.IncCounter(rp.getStatKey("requestProxy.retry.reroute.remote"), nil, 1)
 		}
 
+	case forward.DestinationRemovedEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.retry.departed"), nil, 1)
+
 	case forward.RetrySuccessEvent:
 		rp.statter.IncCounter(rp.getStatKey("requestProxy.retry.succeeded"), nil, 1)
+
+	case forward.HedgeSentEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.hedge.sent"), nil, 1)
+
+	case forward.HedgeWonEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.hedge.won"), nil, 1)
+
+	case forward.BreakerStateChangedEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.breaker."+event.NewState.String()), nil, 1)
+
+	case forward.BreakerRejectedEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.breaker.rejected"), nil, 1)
+
+	case forward.BreakerRerouteEvent:
+		rp.statter.IncCounter(rp.getStatKey("requestProxy.breaker.reroute"), nil, 1)
+
+	case replica.RequestStartedEvent:
+		tags := forwardTags("", "", event.Operation)
+		rp.statter.IncCounter(rp.getStatKey("replicator."+event.Method+".started"), tags, 1)
+
+	case replica.QuorumMetEvent:
+		tags := forwardTags("", "", event.Operation)
+		rp.statter.IncCounter(rp.getStatKey("replicator."+event.Method+".quorum.met"), tags, 1)
+
+	case replica.QuorumFailedEvent:
+		tags := forwardTags("", "", event.Operation)
+		rp.statter.IncCounter(rp.getStatKey("replicator."+event.Method+".quorum.failed"), tags, 1)
+
+	case replica.DestinationErrorEvent:
+		tags := forwardTags(event.Destination, "", event.Operation)
+		rp.statter.IncCounter(rp.getStatKey("replicator."+event.Method+".error"), tags, 1)
+		if event.Outcome == replica.TimedOut {
+			rp.statter.IncCounter(rp.getStatKey("replicator."+event.Method+".timeout"), tags, 1)
+		}
+
+	case replica.FanoutLatencyEvent:
+		tags := forwardTags("", "", event.Operation)
+		rp.statter.RecordTimer(rp.getStatKey("replicator."+event.Method+".latency"), tags, event.Duration)
 	}
 }
 
@@ -580,13 +709,20 @@ func (rp *Ringpop) Checksum() (uint32, error) {
 // for the specified key. It returns an error if the Ringpop instance is not
 // yet initialized/bootstrapped.
 func (rp *Ringpop) Lookup(key string) (string, error) {
+	owner, _, err := rp.lookup(key)
+	return owner, err
+}
+
+// lookup looks up the owner of the key together with the checksum of the ring,
+// and records the stat and emits the event of the lookup.
+func (rp *Ringpop) lookup(key string) (string, uint32, error) {
 	if !rp.Ready() {
-		return "", ErrNotBootstrapped
+		return "", 0, ErrNotBootstrapped
 	}
 
 	startTime := time.Now()
 
-	dest, success := rp.ring.Lookup(key)
+	owner, checksum, ok := rp.ring.LookupChecksum(key)
 
 	duration := time.Now().Sub(startTime)
 	rp.statter.RecordTimer(rp.getStatKey("lookup"), nil, duration)
@@ -596,13 +732,13 @@ func (rp *Ringpop) Lookup(key string) (string, error) {
 		Duration: duration,
 	})
 
-	if !success {
+	if !ok {
 		err := errors.New("could not find destination for key")
 		rp.logger.WithField("key", key).Warn(err)
-		return "", err
+		return "", 0, err
 	}
 
-	return dest, nil
+	return owner, checksum, nil
 }
 
 // LookupN returns the addresses of all the servers in the ring that are
@@ -634,6 +770,16 @@ func (rp *Ringpop) LookupN(key string, n int) ([]string, error) {
 	return destinations, nil
 }
 
+// ReplicaRanges divides the ring into the ranges of hashes that are replicated
+// by the same n servers. It returns an error if the Ringpop instance is not
+// yet initialized/bootstrapped.
+func (rp *Ringpop) ReplicaRanges(n int) ([]hashring.ReplicaRange, error) {
+	if !rp.Ready() {
+		return nil, ErrNotBootstrapped
+	}
+	return rp.ring.ReplicaRanges(n), nil
+}
+
 func (rp *Ringpop) ringEvent(e interface{}) {
 	rp.HandleEvent(e)
 }
@@ -662,6 +808,22 @@ func (rp *Ringpop) CountReachableMembers() (int, error) {
 //
 //= = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = = =
 
+// forwardTags returns the stat tags of a forwarded request. Tags that are not
+// known are left out.
+func forwardTags(destination, service, endpoint string) log.Tags {
+	tags := make(log.Tags, 3)
+	if destination != "" {
+		tags["destination"] = destination
+	}
+	if service != "" {
+		tags["service"] = service
+	}
+	if endpoint != "" {
+		tags["endpoint"] = endpoint
+	}
+	return tags
+}
+
 func (rp *Ringpop) getStatKey(key string) string {
 	rp.stats.Lock()
 	rpKey, ok := rp.stats.keys[key]
@@ -687,28 +849,128 @@ func (rp *Ringpop) getStatKey(key string) string {
 func (rp *Ringpop) HandleOrForward(key string, request []byte, response *[]byte, service, endpoint string,
 	format tchannel.Format, opts *forward.Options) (bool, error) {
 
-	if !rp.Ready() {
-		return false, ErrNotBootstrapped
+	return rp.HandleOrForwardContext(context.Background(), key, request, response, service, endpoint,
+		format, opts)
+}
+
+// HandleOrForwardContext is like HandleOrForward but takes the context of the
+// request that is being handled. When the request is forwarded the deadline
+// and cancellation of the context apply to the forwarded call, and the headers
+// of the context are passed on to the destination.
+//
+// A request that was already forwarded by another node is never forwarded
+// again, which prevents requests from bouncing between nodes that disagree on
+// the membership. When such a request is not owned by this node a
+// forward.LoopDetectedEvent is emitted and, depending on the ForwardLoopPolicy,
+// the request is handled locally or fails with a *ForwardLoopError. Requests
+// in the raw format are only recognized when they were forwarded with
+// forward.Options.RawHeaders and the context was created with
+// forward.ContextWithRawHeaders.
+func (rp *Ringpop) HandleOrForwardContext(ctx context.Context, key string, request []byte, response *[]byte,
+	service, endpoint string, format tchannel.Format, opts *forward.Options) (bool, error) {
+
+	handle, _, err := rp.HandleOrForwardOwnership(ctx, key, request, response, service, endpoint, format, opts)
+	return handle, err
+}
+
+// HandleOrForwardOwnership is like HandleOrForwardContext but also returns the
+// Ownership the decision was made with. A handler that needs to know whether
+// the key moved while it was handling the request can pass the Ownership to
+// StillOwner when it is done.
+//
+// When the request was forwarded by a node whose ring checksum differs from
+// the ring checksum of this node, a forward.ChecksumMismatchEvent is emitted.
+func (rp *Ringpop) HandleOrForwardOwnership(ctx context.Context, key string, request []byte, response *[]byte,
+	service, endpoint string, format tchannel.Format, opts *forward.Options) (bool, *Ownership, error) {
+
+	ownership, err := rp.LookupOwnership(key)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if checksum, ok := forward.SenderChecksum(ctx); ok && checksum != ownership.Checksum {
+		origin, _, _ := forward.ForwardedFrom(ctx)
+		rp.HandleEvent(forward.ChecksumMismatchEvent{
+			Key:            key,
+			Origin:         origin,
+			LocalChecksum:  ownership.Checksum,
+			SenderChecksum: checksum,
+		})
+	}
+
+	if ownership.Local {
+		return true, ownership, nil
 	}
 
-	dest, err := rp.Lookup(key)
+	if origin, hops, forwarded := forward.ForwardedFrom(ctx); forwarded {
+		rp.HandleEvent(forward.LoopDetectedEvent{
+			Key:         key,
+			Origin:      origin,
+			Destination: ownership.Owner,
+			Hops:        hops,
+		})
+
+		if rp.config.ForwardLoopPolicy == FailLoops {
+			return false, ownership, &ForwardLoopError{
+				Key:         key,
+				Origin:      origin,
+				Destination: ownership.Owner,
+				Hops:        hops,
+			}
+		}
+		return true, ownership, nil
+	}
+
+	res, err := rp.ForwardContext(ctx, ownership.Owner, []string{key}, request, service, endpoint, format, opts)
+	*response = res
+
+	return false, ownership, err
+}
+
+// An Ownership records which node owned a key and the checksum of the ring
+// the owner was looked up in.
+type Ownership struct {
+	Key      string
+	Owner    string
+	Local    bool
+	Checksum uint32
+}
+
+// LookupOwnership looks up the owner of the key together with the checksum of
+// the ring, which are guaranteed to be consistent with each other. It returns
+// an error if the Ringpop instance is not yet initialized/bootstrapped.
+func (rp *Ringpop) LookupOwnership(key string) (*Ownership, error) {
+	owner, checksum, err := rp.lookup(key)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	identity, err := rp.WhoAmI()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	if dest == identity {
-		return true, nil
-	}
+	return &Ownership{
+		Key:      key,
+		Owner:    owner,
+		Local:    owner == identity,
+		Checksum: checksum,
+	}, nil
+}
 
-	res, err := rp.Forward(dest, []string{key}, request, service, endpoint, format, opts)
-	*response = res
+// StillOwner returns whether this node owns the key of the Ownership under
+// the current ring. When the ring did not change since the Ownership was
+// looked up, the key is owned when it was owned back then.
+func (rp *Ringpop) StillOwner(ownership *Ownership) (bool, error) {
+	current, err := rp.LookupOwnership(ownership.Key)
+	if err != nil {
+		return false, err
+	}
 
-	return false, err
+	if current.Checksum == ownership.Checksum {
+		return ownership.Local, nil
+	}
+	return current.Local, nil
 }
 
 // Forward forwards the request to given destination host and returns the response.
@@ -718,10 +980,91 @@ func (rp *Ringpop) Forward(dest string, keys []string, request []byte, service,
 	return rp.forwarder.ForwardRequest(request, dest, service, endpoint, keys, format, opts)
 }
 
+// ForwardContext is like Forward but the deadline and cancellation of the
+// context apply to the forwarded call, and the headers of the context are
+// passed on to the destination. When Ringpop is not ready ErrNotBootstrapped
+// is returned.
+func (rp *Ringpop) ForwardContext(ctx context.Context, dest string, keys []string, request []byte,
+	service, endpoint string, format tchannel.Format, opts *forward.Options) ([]byte, error) {
+
+	if !rp.Ready() {
+		return nil, ErrNotBootstrapped
+	}
+
+	return rp.forwarder.ForwardRequestContext(ctx, request, dest, service, endpoint, keys, format, opts)
+}
+
+// ForwardAsync is like ForwardContext but returns immediately with a Future
+// that completes when the forwarded request does. When Ringpop is not ready
+// the Future is completed with ErrNotBootstrapped.
+func (rp *Ringpop) ForwardAsync(ctx context.Context, dest string, keys []string, request []byte,
+	service, endpoint string, format tchannel.Format, opts *forward.Options) *forward.Future {
+
+	if !rp.Ready() {
+		return forward.NewCompletedFuture(nil, ErrNotBootstrapped)
+	}
+
+	return rp.forwarder.ForwardRequestAsync(ctx, request, dest, service, endpoint, keys, format, opts)
+}
+
+// NewProxy returns a TChannel handler that relays inbound calls to the owner
+// of the key returned by key, streaming the arguments and the response without
+// deserializing them. Calls for keys owned by this Ringpop instance are passed
+// to local, which is required. The handler can be registered for any method on
+// a SubChannel before Ringpop is bootstrapped, calls fail with
+// ErrNotBootstrapped until it is.
+//
+// Relayed calls are marked as forwarded and are subject to the inflight
+// limits and circuit breakers of the forwarder. Like HandleOrForwardContext, a
+// call that was already forwarded and is not owned by this node is never
+// relayed again: depending on the ForwardLoopPolicy it is passed to local or
+// rejected. Relayed calls are not retried, hedged or traced, and calls in
+// formats other than JSON, Thrift and raw with JSON headers are relayed
+// without forwarding headers in arg2. See forward.Proxy.
+func (rp *Ringpop) NewProxy(key forward.KeyFunc, local tchannel.Handler) (tchannel.Handler, error) {
+	if local == nil {
+		return nil, forward.ErrNoLocalHandler
+	}
+
+	var opts []forward.ProxyOption
+	if rp.config.ForwardLoopPolicy == FailLoops {
+		opts = append(opts, forward.RejectLoops())
+	}
+
+	return tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		if !rp.Ready() {
+			call.Response().SendSystemError(ErrNotBootstrapped)
+			return
+		}
+
+		proxy, err := rp.forwarder.NewProxy(key, local, opts...)
+		if err != nil {
+			call.Response().SendSystemError(err)
+			return
+		}
+		proxy.Handle(ctx, call)
+	}), nil
+}
+
+// ScatterGather groups the keys by their owner in the ring and sends a
+// request, built by build for every owner, to all owners in parallel. The keys
+// owned by this Ringpop instance are handled in-process by handleLocal, or
+// returned unhandled for the caller when handleLocal is nil. A response is
+// returned per destination, see forward.Forwarder.ScatterRequest.
+func (rp *Ringpop) ScatterGather(ctx context.Context, keys []string, build forward.RequestBuilder,
+	handleLocal forward.LocalHandler, service, endpoint string, format tchannel.Format,
+	opts *forward.Options) ([]forward.ScatterResponse, error) {
+
+	if !rp.Ready() {
+		return nil, ErrNotBootstrapped
+	}
+
+	return rp.forwarder.ScatterRequest(ctx, keys, build, handleLocal, service, endpoint, format, opts)
+}
+
 // SerializeThrift takes a thrift struct and returns the serialized bytes
-// of that struct using the thrift binary protocol. This is a temporary
-// measure before frames can forwarded directly past the endpoint to the proper
-// destinaiton.
+// of that struct using the thrift binary protocol. Requests that do not need
+// to be inspected can be relayed without serialization with NewProxy.
 func SerializeThrift(s athrift.TStruct) ([]byte, error) {
 	var b []byte
 	var buffer = bytes.NewBuffer(b)
@@ -738,9 +1081,8 @@ func SerializeThrift(s athrift.TStruct) ([]byte, error) {
 }
 
 // DeserializeThrift takes a byte slice and attempts to write it into the
-// given thrift struct using the thrift binary protocol. This is a temporary
-// measure before frames can forwarded directly past the endpoint to the proper
-// destinaiton.
+// given thrift struct using the thrift binary protocol. Requests that do not
+// need to be inspected can be relayed without serialization with NewProxy.
 func DeserializeThrift(b []byte, s athrift.TStruct) error {
 	reader := bytes.NewReader(b)
 	transport := athrift.NewStreamTransportR(reader)
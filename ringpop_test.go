@@ -21,19 +21,23 @@
 package ringpop
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"github.com/uber-common/bark"
 	"github.com/uber/ringpop-go/discovery/statichosts"
 	"github.com/uber/ringpop-go/events"
 	eventsmocks "github.com/uber/ringpop-go/events/test/mocks"
 	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/ringpop-go/replica"
 	"github.com/uber/ringpop-go/swim"
 	"github.com/uber/ringpop-go/test/mocks"
 	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
 )
 
 type destroyable interface {
@@ -124,6 +128,10 @@ func (s *RingpopTestSuite) TestCanAssignRingpopToRingpopInterface() {
 	ri = s.ringpop
 
 	s.Assert().Equal(ri, s.ringpop, "ringpop in the interface is not equal to ringpop")
+
+	var rci ContextInterface
+	rci = s.ringpop
+	s.Assert().Equal(rci, s.ringpop, "ringpop in the context interface is not equal to ringpop")
 }
 
 func (s *RingpopTestSuite) TestHandlesMemberlistChangeEvent() {
@@ -345,6 +353,22 @@ func (s *RingpopTestSuite) TestHandleEvents() {
 	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.miscount.decrement"], "missing requestProxy.miscount.decrement stat")
 	// expected listener to record 1 event
 
+	s.ringpop.HandleEvent(forward.InflightLimitRejectedEvent{Global: true})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.inflight.rejected.global"], "missing requestProxy.inflight.rejected.global stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.InflightLimitRejectedEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.inflight.rejected.destination"], "missing requestProxy.inflight.rejected.destination stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.LoopDetectedEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.loop.detected"], "missing requestProxy.loop.detected stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.ChecksumMismatchEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.checksum.mismatch"], "missing requestProxy.checksum.mismatch stat")
+	// expected listener to record 1 event
+
 	s.ringpop.HandleEvent(forward.SuccessEvent{})
 	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.send.success"], "missing requestProxy.send.success stat")
 	// expected listener to record 1 event
@@ -365,6 +389,10 @@ func (s *RingpopTestSuite) TestHandleEvents() {
 	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.retry.aborted"], "missing requestProxy.retry.aborted stat")
 	// expected listener to record 1 event
 
+	s.ringpop.HandleEvent(forward.RetryBudgetExhaustedEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.retry.budget-exhausted"], "missing requestProxy.retry.budget-exhausted stat")
+	// expected listener to record 1 event
+
 	me, _ := s.ringpop.WhoAmI()
 	s.ringpop.HandleEvent(forward.RerouteEvent{
 		OldDestination: genAddresses(1, 1, 1)[0],
@@ -380,12 +408,57 @@ func (s *RingpopTestSuite) TestHandleEvents() {
 	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.retry.reroute.remote"], "missing requestProxy.retry.reroute.remote stat")
 	// expected listener to record 1 event
 
+	s.ringpop.HandleEvent(forward.DestinationRemovedEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.retry.departed"], "missing requestProxy.retry.departed stat")
+	// expected listener to record 1 event
+
 	s.ringpop.HandleEvent(forward.RetrySuccessEvent{NumRetries: 1})
 	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.retry.succeeded"], "missing requestProxy.retry.reroute.remote stat")
 	// expected listener to record 1 event
 
+	s.ringpop.HandleEvent(forward.HedgeSentEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.hedge.sent"], "missing requestProxy.hedge.sent stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.HedgeWonEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.hedge.won"], "missing requestProxy.hedge.won stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.BreakerStateChangedEvent{NewState: forward.BreakerOpen})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.breaker.open"], "missing requestProxy.breaker.open stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.BreakerRejectedEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.breaker.rejected"], "missing requestProxy.breaker.rejected stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(forward.BreakerRerouteEvent{})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.requestProxy.breaker.reroute"], "missing requestProxy.breaker.reroute stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(replica.RequestStartedEvent{Method: "write"})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.replicator.write.started"], "missing replicator.write.started stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(replica.QuorumMetEvent{Method: "write"})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.replicator.write.quorum.met"], "missing replicator.write.quorum.met stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(replica.QuorumFailedEvent{Method: "read"})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.replicator.read.quorum.failed"], "missing replicator.read.quorum.failed stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(replica.DestinationErrorEvent{Method: "read", Outcome: replica.TimedOut})
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.replicator.read.error"], "missing replicator.read.error stat")
+	s.Equal(int64(1), stats.vals["ringpop.127_0_0_1_3001.replicator.read.timeout"], "missing replicator.read.timeout stat")
+	// expected listener to record 1 event
+
+	s.ringpop.HandleEvent(replica.FanoutLatencyEvent{Method: "read", Duration: 10 * time.Millisecond})
+	s.Equal(int64(10), stats.vals["ringpop.127_0_0_1_3001.replicator.read.latency"], "missing replicator.read.latency stat")
+	// expected listener to record 1 event
+
 	time.Sleep(time.Millisecond) // sleep for a bit so that events can be recorded
-	s.Equal(47, listener.EventCount(), "incorrect count for emitted events")
+	s.Equal(63, listener.EventCount(), "incorrect count for emitted events")
 }
 
 func (s *RingpopTestSuite) TestRingpopReady() {
@@ -397,6 +470,93 @@ func (s *RingpopTestSuite) TestRingpopReady() {
 	s.True(s.ringpop.Ready())
 }
 
+func (s *RingpopTestSuite) TestBootstrapAsync() {
+	h := s.ringpop.BootstrapAsync(context.Background(), &swim.BootstrapOptions{
+		DiscoverProvider: statichosts.New("127.0.0.1:3001"),
+	})
+
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		s.Fail("expected asynchronous bootstrap to complete")
+	}
+
+	s.NoError(h.Err())
+	s.True(s.ringpop.Ready())
+}
+
+func (s *RingpopTestSuite) TestBootstrapAsyncWaitsForHosts() {
+	provider := &mutableHostList{}
+
+	h := s.ringpop.BootstrapAsync(context.Background(), &swim.BootstrapOptions{
+		DiscoverProvider: provider,
+	})
+
+	// Bootstrap should not complete as long as there are no hosts.
+	select {
+	case <-h.Done():
+		s.Fail("expected asynchronous bootstrap to wait for hosts")
+	case <-time.After(10 * time.Millisecond):
+	}
+	s.False(s.ringpop.Ready())
+	s.NoError(h.Err())
+	s.Nil(h.Joined())
+
+	provider.setHosts("127.0.0.1:3001")
+
+	// advance the clock until the next attempt has been made
+	for i := 0; i < 100 && s.ringpop.getState() != ready; i++ {
+		s.mockClock.Add(bootstrapRetryInterval)
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		s.Fail("expected asynchronous bootstrap to complete")
+	}
+
+	s.NoError(h.Err())
+	s.True(s.ringpop.Ready())
+}
+
+func (s *RingpopTestSuite) TestBootstrapAsyncCancel() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h := s.ringpop.BootstrapAsync(ctx, &swim.BootstrapOptions{
+		DiscoverProvider: statichosts.New(),
+	})
+	cancel()
+
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		s.Fail("expected asynchronous bootstrap to be cancelled")
+	}
+
+	s.Equal(context.Canceled, h.Err())
+	s.False(s.ringpop.Ready())
+}
+
+func (s *RingpopTestSuite) TestBootstrapContext() {
+	_, err := s.ringpop.BootstrapContext(context.Background(), &swim.BootstrapOptions{
+		DiscoverProvider: statichosts.New("127.0.0.1:3001"),
+	})
+	s.NoError(err)
+	s.True(s.ringpop.Ready())
+}
+
+func (s *RingpopTestSuite) TestBootstrapContextCancelled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.ringpop.BootstrapContext(ctx, &swim.BootstrapOptions{
+		DiscoverProvider: statichosts.New("127.0.0.1:3001"),
+	})
+	s.Equal(context.Canceled, err)
+	s.False(s.ringpop.Ready())
+}
+
 func (s *RingpopTestSuite) TestRingpopNotReady() {
 	// Ringpop should not be ready until bootstrapped
 	s.False(s.ringpop.Ready())
@@ -615,6 +775,281 @@ func (s *RingpopTestSuite) TestLookupN() {
 	s.Equal(5, len(result), "LookupN returns N number of results")
 }
 
+// remoteKey returns a key that is not owned by the ringpop under test.
+func (s *RingpopTestSuite) remoteKey() string {
+	me, _ := s.ringpop.WhoAmI()
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if dest, _ := s.ringpop.Lookup(key); dest != me {
+			return key
+		}
+	}
+}
+
+func forwardedContext() context.Context {
+	return forward.ContextWithRawHeaders(context.Background(),
+		[]byte(`{"ringpop-forwarded":"true","ringpop-hops":"1","ringpop-origin":"127.0.0.1:3010"}`))
+}
+
+// TestHandleOrForwardLoopHandledLocally tests that a request that was already
+// forwarded is handled locally instead of being forwarded again.
+func (s *RingpopTestSuite) TestHandleOrForwardLoopHandledLocally() {
+	createSingleNodeCluster(s.ringpop)
+	s.ringpop.ring.AddRemoveServers(genAddresses(1, 10, 20), nil)
+
+	called := make(chan bool, 1)
+
+	l := &eventsmocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("forward.LoopDetectedEvent")).Return().Run(func(args mock.Arguments) {
+		called <- true
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	s.ringpop.RegisterListener(l)
+
+	var response []byte
+	handle, err := s.ringpop.HandleOrForwardContext(forwardedContext(), s.remoteKey(), nil, &response,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.NoError(err)
+	s.True(handle, "expected a forwarded request to be handled locally")
+
+	// block with timeout for event to be emitted
+	select {
+	case <-called:
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	l.AssertCalled(s.T(), "HandleEvent", mock.AnythingOfType("forward.LoopDetectedEvent"))
+}
+
+// TestHandleOrForwardLoopFails tests that a request that was already forwarded
+// fails when loops are configured to fail.
+func (s *RingpopTestSuite) TestHandleOrForwardLoopFails() {
+	createSingleNodeCluster(s.ringpop)
+	s.ringpop.ring.AddRemoveServers(genAddresses(1, 10, 20), nil)
+	s.ringpop.config.ForwardLoopPolicy = FailLoops
+
+	key := s.remoteKey()
+	dest, _ := s.ringpop.Lookup(key)
+
+	var response []byte
+	handle, err := s.ringpop.HandleOrForwardContext(forwardedContext(), key, nil, &response,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.False(handle)
+	s.Equal(&ForwardLoopError{
+		Key:         key,
+		Origin:      "127.0.0.1:3010",
+		Destination: dest,
+		Hops:        1,
+	}, err)
+}
+
+// TestForwardStatsTagged tests that the outcome of a forwarded request is
+// recorded per destination.
+func (s *RingpopTestSuite) TestForwardStatsTagged() {
+	createSingleNodeCluster(s.ringpop)
+
+	stats := &mocks.StatsReporter{}
+	stats.On("IncCounter", mock.Anything, mock.Anything, mock.Anything)
+	stats.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything)
+	stats.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything)
+	s.ringpop.statter = stats
+
+	s.ringpop.HandleEvent(forward.SuccessEvent{
+		Destination: "127.0.0.1:3002",
+		Service:     "test",
+		Endpoint:    "/endpoint",
+		Duration:    10 * time.Millisecond,
+		Attempts:    2,
+	})
+
+	tags := bark.Tags{
+		"destination": "127.0.0.1:3002",
+		"service":     "test",
+		"endpoint":    "/endpoint",
+	}
+	stats.AssertCalled(s.T(), "IncCounter", "ringpop.127_0_0_1_3001.requestProxy.send.success", tags, int64(1))
+	stats.AssertCalled(s.T(), "IncCounter", "ringpop.127_0_0_1_3001.requestProxy.send.attempts", tags, int64(2))
+	stats.AssertCalled(s.T(), "RecordTimer", "ringpop.127_0_0_1_3001.requestProxy.send.latency", tags, 10*time.Millisecond)
+
+	s.ringpop.HandleEvent(forward.FailedEvent{
+		Destination: "127.0.0.1:3002",
+		Service:     "test",
+		Endpoint:    "/endpoint",
+		Duration:    time.Second,
+		Attempts:    1,
+	})
+	stats.AssertCalled(s.T(), "RecordTimer", "ringpop.127_0_0_1_3001.requestProxy.send.error.latency", tags, time.Second)
+	stats.AssertNotCalled(s.T(), "RecordTimer", "ringpop.127_0_0_1_3001.requestProxy.send.latency", tags, time.Second)
+}
+
+// TestAdminForwardingSummary tests that the admin endpoint summarizes the
+// requests recently forwarded to every destination.
+func (s *RingpopTestSuite) TestAdminForwardingSummary() {
+	createSingleNodeCluster(s.ringpop)
+
+	// nothing listens on port 0
+	_, err := s.ringpop.Forward("127.0.0.1:0", nil, nil, "test", "/endpoint", tchannel.JSON,
+		&forward.Options{Retryable: func(error) bool { return false }})
+	s.Error(err)
+
+	summary, err := s.ringpop.adminForwardingHandler(nil, &Arg{})
+	s.NoError(err)
+	s.Equal(1, summary["127.0.0.1:0"].Requests)
+	s.Equal(1, summary["127.0.0.1:0"].Errors)
+	s.Equal(1.0, summary["127.0.0.1:0"].ErrorRate)
+}
+
+// TestLookupOwnership tests that the ownership of a key carries the checksum
+// of the ring it was looked up in.
+func (s *RingpopTestSuite) TestLookupOwnership() {
+	createSingleNodeCluster(s.ringpop)
+
+	ownership, err := s.ringpop.LookupOwnership("foo")
+	s.NoError(err)
+	s.Equal("foo", ownership.Key)
+	s.Equal("127.0.0.1:3001", ownership.Owner)
+	s.True(ownership.Local)
+	s.Equal(s.ringpop.ring.Checksum(), ownership.Checksum)
+}
+
+// TestLookupOwnershipNotReady tests that ownership can not be looked up when
+// Ringpop is not ready.
+func (s *RingpopTestSuite) TestLookupOwnershipNotReady() {
+	ownership, err := s.ringpop.LookupOwnership("foo")
+	s.Equal(ErrNotBootstrapped, err)
+	s.Nil(ownership)
+}
+
+// TestStillOwner tests that ownership is rechecked against the current ring.
+func (s *RingpopTestSuite) TestStillOwner() {
+	createSingleNodeCluster(s.ringpop)
+
+	ownership, err := s.ringpop.LookupOwnership("foo")
+	s.NoError(err)
+
+	owner, err := s.ringpop.StillOwner(ownership)
+	s.NoError(err)
+	s.True(owner, "expected the key to be owned while the ring is unchanged")
+
+	s.ringpop.ring.AddRemoveServers(genAddresses(1, 10, 20), nil)
+	ownership.Key = s.remoteKey()
+
+	owner, err = s.ringpop.StillOwner(ownership)
+	s.NoError(err)
+	s.False(owner, "expected the key to have moved after the ring changed")
+}
+
+// TestHandleOrForwardOwnership tests that the decision to handle a request
+// locally is returned with the ownership it was made with.
+func (s *RingpopTestSuite) TestHandleOrForwardOwnership() {
+	createSingleNodeCluster(s.ringpop)
+
+	var response []byte
+	handle, ownership, err := s.ringpop.HandleOrForwardOwnership(context.Background(), "foo", nil, &response,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.NoError(err)
+	s.True(handle)
+	s.Equal(&Ownership{
+		Key:      "foo",
+		Owner:    "127.0.0.1:3001",
+		Local:    true,
+		Checksum: s.ringpop.ring.Checksum(),
+	}, ownership)
+}
+
+// TestHandleOrForwardChecksumMismatch tests that a forwarded request from a
+// node with a different ring checksum is reported.
+func (s *RingpopTestSuite) TestHandleOrForwardChecksumMismatch() {
+	createSingleNodeCluster(s.ringpop)
+
+	called := make(chan bool, 1)
+
+	l := &eventsmocks.EventListener{}
+	l.On("HandleEvent", mock.AnythingOfType("forward.ChecksumMismatchEvent")).Return().Run(func(args mock.Arguments) {
+		called <- true
+	})
+	l.On("HandleEvent", mock.Anything).Return()
+	s.ringpop.RegisterListener(l)
+
+	ctx := forward.ContextWithRawHeaders(context.Background(),
+		[]byte(`{"ringpop-forwarded":"true","ringpop-hops":"1","ringpop-origin":"127.0.0.1:3010","ringpop-checksum":"1"}`))
+
+	var response []byte
+	handle, err := s.ringpop.HandleOrForwardContext(ctx, "foo", nil, &response,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.NoError(err)
+	s.True(handle)
+
+	// block with timeout for event to be emitted
+	select {
+	case <-called:
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	l.AssertCalled(s.T(), "HandleEvent", forward.ChecksumMismatchEvent{
+		Key:            "foo",
+		Origin:         "127.0.0.1:3010",
+		LocalChecksum:  s.ringpop.ring.Checksum(),
+		SenderChecksum: 1,
+	})
+}
+
+// TestForwardContextNotReady tests that ForwardContext fails when Ringpop is
+// not ready, like ForwardAsync.
+func (s *RingpopTestSuite) TestForwardContextNotReady() {
+	res, err := s.ringpop.ForwardContext(context.Background(), "127.0.0.1:3002", []string{"foo"}, nil,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.Equal(ErrNotBootstrapped, err)
+	s.Nil(res)
+}
+
+// TestForwardAsyncNotReady tests that the future returned by ForwardAsync
+// fails when Ringpop is not ready.
+func (s *RingpopTestSuite) TestForwardAsyncNotReady() {
+	future := s.ringpop.ForwardAsync(context.Background(), "127.0.0.1:3002", []string{"foo"}, nil,
+		"test", "/endpoint", tchannel.JSON, nil)
+
+	_, err := future.Result()
+	s.Equal(ErrNotBootstrapped, err)
+}
+
+// TestNewProxyRequiresLocal tests that a proxy cannot be created without a
+// handler for the keys owned by this Ringpop instance.
+func (s *RingpopTestSuite) TestNewProxyRequiresLocal() {
+	handler, err := s.ringpop.NewProxy(forward.ShardKey, nil)
+	s.Equal(forward.ErrNoLocalHandler, err)
+	s.Nil(handler)
+}
+
+// TestScatterGatherNotReady tests that ScatterGather fails when Ringpop is
+// not ready.
+func (s *RingpopTestSuite) TestScatterGatherNotReady() {
+	result, err := s.ringpop.ScatterGather(context.Background(), []string{"foo"},
+		func(string, []string) ([]byte, error) { return nil, nil }, nil,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.Equal(ErrNotBootstrapped, err)
+	s.Nil(result)
+}
+
+// TestScatterGatherLocal tests that keys owned by this Ringpop instance are
+// returned for the caller to handle when no local handler is given.
+func (s *RingpopTestSuite) TestScatterGatherLocal() {
+	createSingleNodeCluster(s.ringpop)
+
+	address, _ := s.ringpop.identity()
+
+	result, err := s.ringpop.ScatterGather(context.Background(), []string{"foo", "bar"},
+		func(dest string, keys []string) ([]byte, error) { return []byte(dest), nil }, nil,
+		"test", "/endpoint", tchannel.JSON, nil)
+	s.NoError(err)
+	s.Equal([]forward.ScatterResponse{{
+		Destination: address,
+		Keys:        []string{"foo", "bar"},
+		Local:       true,
+		Request:     []byte(address),
+	}}, result)
+}
+
 // TestGetReachableMembersNotReady tests that GetReachableMembers fails when
 // Ringpop is not ready.
 func (s *RingpopTestSuite) TestGetReachableMembersNotReady() {
@@ -7,10 +7,14 @@ import "time"
 import "github.com/uber/ringpop-go/events"
 import "github.com/uber/ringpop-go/forward"
 
+import "github.com/uber/ringpop-go/hashring"
+
 import "github.com/uber/ringpop-go/swim"
 
 import "github.com/uber/tchannel-go"
 
+import "golang.org/x/net/context"
+
 type Ringpop struct {
 	mock.Mock
 }
@@ -104,6 +108,29 @@ func (_m *Ringpop) Bootstrap(opts *swim.BootstrapOptions) ([]string, error) {
 	return r0, r1
 }
 
+// BootstrapContext provides a mock function with given fields: ctx, opts
+func (_m *Ringpop) BootstrapContext(ctx context.Context, opts *swim.BootstrapOptions) ([]string, error) {
+	ret := _m.Called(ctx, opts)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, *swim.BootstrapOptions) []string); ok {
+		r0 = rf(ctx, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *swim.BootstrapOptions) error); ok {
+		r1 = rf(ctx, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Checksum provides a mock function with given fields:
 func (_m *Ringpop) Checksum() (uint32, error) {
 	ret := _m.Called()
@@ -169,6 +196,29 @@ func (_m *Ringpop) LookupN(key string, n int) ([]string, error) {
 	return r0, r1
 }
 
+// ReplicaRanges provides a mock function with given fields: n
+func (_m *Ringpop) ReplicaRanges(n int) ([]hashring.ReplicaRange, error) {
+	ret := _m.Called(n)
+
+	var r0 []hashring.ReplicaRange
+	if rf, ok := ret.Get(0).(func(int) []hashring.ReplicaRange); ok {
+		r0 = rf(n)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]hashring.ReplicaRange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(int) error); ok {
+		r1 = rf(n)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetReachableMembers provides a mock function with given fields:
 func (_m *Ringpop) GetReachableMembers() ([]string, error) {
 	ret := _m.Called()
@@ -256,3 +306,86 @@ func (_m *Ringpop) Forward(dest string, keys []string, request []byte, service s
 
 	return r0, r1
 }
+
+// HandleOrForwardContext provides a mock function with given fields: ctx, key, request, response, service, endpoint, format, opts
+func (_m *Ringpop) HandleOrForwardContext(ctx context.Context, key string, request []byte, response *[]byte, service string, endpoint string, format tchannel.Format, opts *forward.Options) (bool, error) {
+	ret := _m.Called(ctx, key, request, response, service, endpoint, format, opts)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, *[]byte, string, string, tchannel.Format, *forward.Options) bool); ok {
+		r0 = rf(ctx, key, request, response, service, endpoint, format, opts)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte, *[]byte, string, string, tchannel.Format, *forward.Options) error); ok {
+		r1 = rf(ctx, key, request, response, service, endpoint, format, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ForwardContext provides a mock function with given fields: ctx, dest, keys, request, service, endpoint, format, opts
+func (_m *Ringpop) ForwardContext(ctx context.Context, dest string, keys []string, request []byte, service string, endpoint string, format tchannel.Format, opts *forward.Options) ([]byte, error) {
+	ret := _m.Called(ctx, dest, keys, request, service, endpoint, format, opts)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string, []byte, string, string, tchannel.Format, *forward.Options) []byte); ok {
+		r0 = rf(ctx, dest, keys, request, service, endpoint, format, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string, []byte, string, string, tchannel.Format, *forward.Options) error); ok {
+		r1 = rf(ctx, dest, keys, request, service, endpoint, format, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ForwardAsync provides a mock function with given fields: ctx, dest, keys, request, service, endpoint, format, opts
+func (_m *Ringpop) ForwardAsync(ctx context.Context, dest string, keys []string, request []byte, service string, endpoint string, format tchannel.Format, opts *forward.Options) *forward.Future {
+	ret := _m.Called(ctx, dest, keys, request, service, endpoint, format, opts)
+
+	var r0 *forward.Future
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string, []byte, string, string, tchannel.Format, *forward.Options) *forward.Future); ok {
+		r0 = rf(ctx, dest, keys, request, service, endpoint, format, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*forward.Future)
+		}
+	}
+
+	return r0
+}
+
+// ScatterGather provides a mock function with given fields: ctx, keys, build, handleLocal, service, endpoint, format, opts
+func (_m *Ringpop) ScatterGather(ctx context.Context, keys []string, build forward.RequestBuilder, handleLocal forward.LocalHandler, service string, endpoint string, format tchannel.Format, opts *forward.Options) ([]forward.ScatterResponse, error) {
+	ret := _m.Called(ctx, keys, build, handleLocal, service, endpoint, format, opts)
+
+	var r0 []forward.ScatterResponse
+	if rf, ok := ret.Get(0).(func(context.Context, []string, forward.RequestBuilder, forward.LocalHandler, string, string, tchannel.Format, *forward.Options) []forward.ScatterResponse); ok {
+		r0 = rf(ctx, keys, build, handleLocal, service, endpoint, format, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]forward.ScatterResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string, forward.RequestBuilder, forward.LocalHandler, string, string, tchannel.Format, *forward.Options) error); ok {
+		r1 = rf(ctx, keys, build, handleLocal, service, endpoint, format, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -95,3 +95,22 @@ func genChanges(addresses []string, statuses ...string) []swim.Change {
 
 	return changes
 }
+
+// discover provider with a host list that can be changed during a test
+type mutableHostList struct {
+	l     sync.Mutex
+	hosts []string
+}
+
+func (m *mutableHostList) setHosts(hosts ...string) {
+	m.l.Lock()
+	m.hosts = hosts
+	m.l.Unlock()
+}
+
+func (m *mutableHostList) Hosts() ([]string, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	return m.hosts, nil
+}
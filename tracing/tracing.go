@@ -0,0 +1,132 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package tracing defines the minimal tracer interface ringpop uses to create
+// spans around forwarded and replicated requests and to propagate them to the
+// destination. The interface is modeled after OpenTracing so that existing
+// tracers can be adapted with a thin wrapper.
+package tracing
+
+import "golang.org/x/net/context"
+
+// A SpanContext is the part of a span that is propagated to other processes.
+// Its contents are defined by the Tracer implementation.
+type SpanContext interface{}
+
+// A Span represents a single operation that is being traced.
+type Span interface {
+	// Context returns the SpanContext of the span, which is used as the
+	// parent of child spans and injected into outgoing requests.
+	Context() SpanContext
+
+	// SetTag adds a tag to the span.
+	SetTag(key string, value interface{})
+
+	// Finish marks the end of the span.
+	Finish()
+}
+
+// A Tracer creates spans and propagates them through request headers.
+type Tracer interface {
+	// StartSpan starts a new span with the given operation name. The parent
+	// can be nil in which case a root span is started.
+	StartSpan(operationName string, parent SpanContext) Span
+
+	// Inject writes the SpanContext into the headers of an outgoing request.
+	Inject(sc SpanContext, headers map[string]string) error
+
+	// Extract reads a SpanContext from the headers of an incoming request.
+	// It returns nil when the headers do not carry a span.
+	Extract(headers map[string]string) (SpanContext, error)
+}
+
+// NoopTracer is a Tracer that does not record or propagate anything. It is the
+// default tracer used by ringpop.
+type NoopTracer struct{}
+
+// StartSpan returns a span that does nothing.
+func (NoopTracer) StartSpan(operationName string, parent SpanContext) Span {
+	return noopSpan{}
+}
+
+// Inject does not write any headers.
+func (NoopTracer) Inject(sc SpanContext, headers map[string]string) error {
+	return nil
+}
+
+// Extract never finds a span.
+func (NoopTracer) Extract(headers map[string]string) (SpanContext, error) {
+	return nil, nil
+}
+
+type noopSpan struct{}
+
+func (noopSpan) Context() SpanContext                 { return nil }
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) Finish()                              {}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a new context that carries the span. Spans created
+// by ringpop for requests made with this context become children of the span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by the context or nil.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// contextWithHeaders is implemented by the contexts TChannel passes to
+// handlers, which carry the headers of the incoming request.
+type contextWithHeaders interface {
+	Headers() map[string]string
+}
+
+// ParentFromContext returns the SpanContext that should be the parent of spans
+// created for a request made with the context. A span carried by the context
+// takes precedence over a span that is extracted from the headers of the
+// incoming request the context belongs to.
+func ParentFromContext(tracer Tracer, ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context()
+	}
+
+	if hctx, ok := ctx.(contextWithHeaders); ok {
+		if sc, err := tracer.Extract(hctx.Headers()); err == nil {
+			return sc
+		}
+	}
+
+	return nil
+}
+
+// StartSpanFromHeaders starts a span for handling an incoming request. The span
+// becomes a child of the span that is extracted from the request headers, if
+// any. This is used on the receiving side of forwarded requests.
+func StartSpanFromHeaders(tracer Tracer, operationName string, headers map[string]string) Span {
+	parent, err := tracer.Extract(headers)
+	if err != nil {
+		parent = nil
+	}
+	return tracer.StartSpan(operationName, parent)
+}
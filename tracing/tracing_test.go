@@ -0,0 +1,89 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+type headerTracer struct {
+	NoopTracer
+}
+
+func (headerTracer) Extract(headers map[string]string) (SpanContext, error) {
+	if id, ok := headers["span"]; ok {
+		return id, nil
+	}
+	return nil, nil
+}
+
+type headerContext struct {
+	context.Context
+	headers map[string]string
+}
+
+func (c headerContext) Headers() map[string]string {
+	return c.headers
+}
+
+type idSpan struct {
+	noopSpan
+	id string
+}
+
+func (s idSpan) Context() SpanContext {
+	return s.id
+}
+
+func TestSpanFromContext(t *testing.T) {
+	assert.Nil(t, SpanFromContext(context.Background()))
+
+	span := idSpan{id: "span"}
+	ctx := ContextWithSpan(context.Background(), span)
+	assert.Equal(t, span, SpanFromContext(ctx))
+}
+
+func TestParentFromContext(t *testing.T) {
+	tracer := headerTracer{}
+
+	assert.Nil(t, ParentFromContext(tracer, context.Background()))
+
+	ctx := headerContext{context.Background(), map[string]string{"span": "remote"}}
+	assert.Equal(t, "remote", ParentFromContext(tracer, ctx), "expected parent from headers")
+
+	withSpan := ContextWithSpan(ctx, idSpan{id: "local"})
+	assert.Equal(t, "local", ParentFromContext(tracer, withSpan), "expected span in context to take precedence")
+}
+
+func TestNoopTracer(t *testing.T) {
+	headers := make(map[string]string)
+	span := NoopTracer{}.StartSpan("operation", nil)
+
+	assert.NoError(t, NoopTracer{}.Inject(span.Context(), headers))
+	assert.Empty(t, headers)
+
+	sc, err := NoopTracer{}.Extract(map[string]string{"span": "remote"})
+	assert.NoError(t, err)
+	assert.Nil(t, sc)
+}